@@ -0,0 +1,338 @@
+package base
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// ErrChecksumMismatch for a snapshot whose content does not match its checksum file
+var ErrChecksumMismatch = errors.New("db: snapshot checksum mismatch")
+
+// ErrNoChecksum for a snapshot without a checksum file
+var ErrNoChecksum = errors.New("db: snapshot has no checksum file")
+
+// snapshotPrefix and snapshotExt name the files written by the scheduler
+const (
+	snapshotPrefix = "base-"
+	snapshotExt    = ".db"
+	checksumExt    = ".sha256"
+	snapshotLayout = "20060102T150405Z"
+)
+
+// WriteSnapshot writes a consistent copy of the database to w from a read
+// transaction, so writers are not blocked
+func (db *DB) WriteSnapshot(w io.Writer) (int64, error) {
+	var n int64
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
+
+// SnapshotToFile writes a snapshot to path and its SHA-256 checksum to
+// path.sha256. Both are written to temporary files first and the checksum
+// is moved into place before the snapshot, so path never holds a partial
+// copy nor a snapshot without its checksum. It return the hex checksum.
+func (db *DB) SnapshotToFile(path string) (string, error) {
+	tmp := path + ".tmp"
+	h := sha256.New()
+	err := writeFile(tmp, func(w io.Writer) error {
+		_, err := db.WriteSnapshot(io.MultiWriter(w, h))
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	line := fmt.Sprintf("%s  %s\n", sum, filepath.Base(path))
+	err = writeFile(path+checksumExt+".tmp", func(w io.Writer) error {
+		_, err := io.WriteString(w, line)
+		return err
+	})
+	if err == nil {
+		err = os.Rename(path+checksumExt+".tmp", path+checksumExt)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		os.Remove(path + checksumExt + ".tmp")
+		return "", err
+	}
+	return sum, nil
+}
+
+// writeFile creates the file at path with the content written by fn and
+// syncs it. The file is removed when fn or the sync fails.
+func writeFile(path string, fn func(io.Writer) error) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	err = fn(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// VerifySnapshot checks the snapshot at path against its checksum file
+// and checks the consistency of the bolt file. A missing checksum file is
+// an error, ErrNoChecksum, unless noChecksum is set.
+func VerifySnapshot(path string, noChecksum bool) error {
+	want, err := readChecksum(path, noChecksum)
+	if err != nil {
+		return err
+	}
+	if want != "" {
+		sum, err := fileChecksum(path)
+		if err != nil {
+			return err
+		}
+		if sum != want {
+			return ErrChecksumMismatch
+		}
+	}
+	return checkBolt(path)
+}
+
+// readChecksum return the checksum recorded in the checksum file of the
+// snapshot at path, or "" when there is none and noChecksum is set
+func readChecksum(path string, noChecksum bool) (string, error) {
+	buf, err := os.ReadFile(path + checksumExt)
+	switch {
+	case err == nil:
+		fields := strings.Fields(string(buf))
+		if len(fields) == 0 {
+			return "", fmt.Errorf("db: empty checksum file %s", path+checksumExt)
+		}
+		return fields[0], nil
+	case !os.IsNotExist(err):
+		return "", err
+	case !noChecksum:
+		return "", ErrNoChecksum
+	}
+	return "", nil
+}
+
+// checkBolt checks the consistency of the bolt file at path
+func checkBolt(path string) error {
+	boltdb, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return fmt.Errorf("db: cannot open snapshot: %s", err)
+	}
+	defer boltdb.Close()
+	return boltdb.View(func(tx *bolt.Tx) error {
+		// Drain every error so the check goroutine ends before the tx closes
+		var first error
+		for err := range tx.Check() {
+			if first == nil {
+				first = fmt.Errorf("db: snapshot is corrupt: %s", err)
+			}
+		}
+		return first
+	})
+}
+
+// RestoreSnapshot copies the snapshot at src next to dst, verifies the
+// copy like VerifySnapshot, and then replaces the database file at dst
+// with it. When keep is not empty the current database is moved to keep
+// first, and moved back when the replacement fails. dst is left untouched
+// when the copy or the verification fails. The database at dst must not
+// be open by another process.
+func RestoreSnapshot(src, dst string, noChecksum bool, keep string) error {
+	want, err := readChecksum(src, noChecksum)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + ".restore"
+	h := sha256.New()
+	err = writeFile(tmp, func(w io.Writer) error {
+		_, err := io.Copy(io.MultiWriter(w, h), in)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if want != "" && hex.EncodeToString(h.Sum(nil)) != want {
+		err = ErrChecksumMismatch
+	}
+	if err == nil {
+		err = checkBolt(tmp)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if keep != "" {
+		if err := os.Rename(dst, keep); err != nil && !os.IsNotExist(err) {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		if keep != "" {
+			os.Rename(keep, dst)
+		}
+		return err
+	}
+	return nil
+}
+
+// fileChecksum return the hex SHA-256 of the file at path
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// SnapshotName return the file name of a scheduled snapshot taken at t
+func SnapshotName(t time.Time) string {
+	return snapshotPrefix + t.UTC().Format(snapshotLayout) + snapshotExt
+}
+
+// ListSnapshots return the scheduled snapshots in dir, oldest first
+func ListSnapshots(dir string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, snapshotPrefix+"*"+snapshotExt))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// PruneSnapshots removes all but the newest keep snapshots in dir
+func PruneSnapshots(dir string, keep int) error {
+	snapshots, err := ListSnapshots(dir)
+	if err != nil {
+		return err
+	}
+	for len(snapshots) > keep {
+		if err := os.Remove(snapshots[0]); err != nil {
+			return err
+		}
+		if err := os.Remove(snapshots[0] + checksumExt); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		snapshots = snapshots[1:]
+	}
+	return nil
+}
+
+// SnapshotScheduler takes snapshots into a directory at a fixed interval
+// and keeps the newest ones
+type SnapshotScheduler struct {
+	db       *DB
+	dir      string
+	interval time.Duration
+	keep     int
+
+	mu   sync.Mutex
+	quit chan struct{}
+	done chan struct{}
+}
+
+// NewSnapshotScheduler return a scheduler writing snapshots of db to dir
+// every interval and keeping the newest keep snapshots
+func NewSnapshotScheduler(db *DB, dir string, interval time.Duration, keep int) *SnapshotScheduler {
+	return &SnapshotScheduler{db: db, dir: dir, interval: interval, keep: keep}
+}
+
+// Snapshot takes a snapshot now and prunes old ones. It return the path
+// of the new snapshot.
+func (s *SnapshotScheduler) Snapshot() (string, error) {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(s.dir, SnapshotName(TimeNow()))
+	if _, err := s.db.SnapshotToFile(path); err != nil {
+		return "", err
+	}
+	if s.keep > 0 {
+		if err := PruneSnapshots(s.dir, s.keep); err != nil {
+			return path, err
+		}
+	}
+	return path, nil
+}
+
+// Start takes snapshots every interval until Close is called.
+// errFn, if not nil, receives snapshot errors.
+func (s *SnapshotScheduler) Start(errFn func(error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.quit != nil {
+		return
+	}
+	s.quit = make(chan struct{})
+	s.done = make(chan struct{})
+	go func(quit, done chan struct{}) {
+		defer close(done)
+		t := time.NewTicker(s.interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if _, err := s.Snapshot(); err != nil && errFn != nil {
+					errFn(err)
+				}
+			case <-quit:
+				return
+			}
+		}
+	}(s.quit, s.done)
+}
+
+// Running reports whether the scheduler goroutine is alive
+func (s *SnapshotScheduler) Running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return alive(s.done)
+}
+
+// Close stops the scheduler and waits for a running snapshot to finish
+func (s *SnapshotScheduler) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.quit == nil {
+		return
+	}
+	close(s.quit)
+	<-s.done
+	s.quit, s.done = nil, nil
+}
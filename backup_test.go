@@ -0,0 +1,208 @@
+package base
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// snapshotWithUser return the path of a snapshot of a db holding one user
+func snapshotWithUser(t *testing.T) string {
+	t.Helper()
+	db := newTestDB(t)
+	createUser(t, db.Users(), "a@example.com")
+	path := filepath.Join(t.TempDir(), "snap.db")
+	sum, err := db.SnapshotToFile(path)
+	if err != nil {
+		t.Fatalf("snapshot: %s", err)
+	}
+	if len(sum) != 64 {
+		t.Errorf("checksum = %q", sum)
+	}
+	return path
+}
+
+func TestWriteSnapshot(t *testing.T) {
+	db := newTestDB(t)
+	var buf bytes.Buffer
+	n, err := db.WriteSnapshot(&buf)
+	if err != nil {
+		t.Fatalf("write snapshot: %s", err)
+	}
+	if n != int64(buf.Len()) || n == 0 {
+		t.Errorf("wrote %d bytes, buffer has %d", n, buf.Len())
+	}
+}
+
+func TestVerifySnapshot(t *testing.T) {
+	path := snapshotWithUser(t)
+	if err := VerifySnapshot(path, false); err != nil {
+		t.Fatalf("verify: %s", err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left: %v", err)
+	}
+
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %s", err)
+	}
+	buf[len(buf)-1] ^= 0xff
+	if err := os.WriteFile(path, buf, 0600); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	if err := VerifySnapshot(path, false); err != ErrChecksumMismatch {
+		t.Errorf("verify changed snapshot = %v, want %v", err, ErrChecksumMismatch)
+	}
+}
+
+func TestVerifySnapshotWithoutChecksum(t *testing.T) {
+	path := snapshotWithUser(t)
+	if err := os.Remove(path + checksumExt); err != nil {
+		t.Fatalf("remove checksum: %s", err)
+	}
+	if err := VerifySnapshot(path, false); err != ErrNoChecksum {
+		t.Errorf("verify = %v, want %v", err, ErrNoChecksum)
+	}
+	if err := VerifySnapshot(path, true); err != nil {
+		t.Errorf("verify without checksum: %s", err)
+	}
+
+	// The bolt file itself is still checked
+	if err := os.WriteFile(path, []byte("not a database"), 0600); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	if err := VerifySnapshot(path, true); err == nil {
+		t.Error("verify of a broken file did not fail")
+	}
+}
+
+func TestRestoreSnapshot(t *testing.T) {
+	src := snapshotWithUser(t)
+	dst := filepath.Join(t.TempDir(), "restored.db")
+	if err := RestoreSnapshot(src, dst, false, ""); err != nil {
+		t.Fatalf("restore: %s", err)
+	}
+
+	boltdb, err := bolt.Open(dst, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("open restored: %s", err)
+	}
+	db := &DB{DB: boltdb}
+	defer db.Close()
+	if _, err := db.Users().GetByEmail("a@example.com"); err != nil {
+		t.Errorf("user in restored db: %s", err)
+	}
+
+	os.Remove(src + checksumExt)
+	if err := RestoreSnapshot(src, dst, false, ""); err != ErrNoChecksum {
+		t.Errorf("restore without checksum = %v, want %v", err, ErrNoChecksum)
+	}
+}
+
+func TestRestoreSnapshotKeepsCurrent(t *testing.T) {
+	src := snapshotWithUser(t)
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "base.db")
+	keep := dst + ".pre-restore"
+	current := []byte("current database")
+	if err := os.WriteFile(dst, current, 0600); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+
+	// A snapshot failing verification leaves the current database in place
+	sum, err := os.ReadFile(src + checksumExt)
+	if err != nil {
+		t.Fatalf("read checksum: %s", err)
+	}
+	sum[0] ^= 1
+	if err := os.WriteFile(src+checksumExt, sum, 0600); err != nil {
+		t.Fatalf("write checksum: %s", err)
+	}
+	if err := RestoreSnapshot(src, dst, false, keep); err != ErrChecksumMismatch {
+		t.Fatalf("restore = %v, want %v", err, ErrChecksumMismatch)
+	}
+	if buf, err := os.ReadFile(dst); err != nil || !bytes.Equal(buf, current) {
+		t.Errorf("current database after failed restore = %q, %v", buf, err)
+	}
+	if _, err := os.Stat(keep); !os.IsNotExist(err) {
+		t.Errorf("%s after failed restore: %v", keep, err)
+	}
+	if _, err := os.Stat(dst + ".restore"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left: %v", err)
+	}
+
+	if err := RestoreSnapshot(src, dst, true, keep); err != ErrChecksumMismatch {
+		t.Errorf("restore with a checksum file and noChecksum = %v, want %v", err, ErrChecksumMismatch)
+	}
+	os.Remove(src + checksumExt)
+	if err := RestoreSnapshot(src, dst, true, keep); err != nil {
+		t.Fatalf("restore: %s", err)
+	}
+	if buf, err := os.ReadFile(keep); err != nil || !bytes.Equal(buf, current) {
+		t.Errorf("kept database = %q, %v", buf, err)
+	}
+	if err := checkBolt(dst); err != nil {
+		t.Errorf("restored database: %s", err)
+	}
+}
+
+func TestSnapshotToFileWritesChecksumFirst(t *testing.T) {
+	path := snapshotWithUser(t)
+	for _, p := range []string{path + ".tmp", path + checksumExt + ".tmp"} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("temporary file %s left: %v", p, err)
+		}
+	}
+	want, err := readChecksum(path, false)
+	if err != nil {
+		t.Fatalf("read checksum: %s", err)
+	}
+	if sum, err := fileChecksum(path); err != nil || sum != want {
+		t.Errorf("checksum = %s, %v, want %s", sum, err, want)
+	}
+}
+
+func TestSnapshotScheduler(t *testing.T) {
+	db := newTestDB(t)
+	dir := filepath.Join(t.TempDir(), "backups")
+	s := NewSnapshotScheduler(db, dir, time.Hour, 2)
+
+	// Snapshots are named by the second they are taken
+	for _, name := range []string{SnapshotName(time.Unix(0, 0)), SnapshotName(time.Unix(1, 0))} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatalf("mkdir: %s", err)
+		}
+		if _, err := db.SnapshotToFile(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("snapshot: %s", err)
+		}
+	}
+	path, err := s.Snapshot()
+	if err != nil {
+		t.Fatalf("scheduled snapshot: %s", err)
+	}
+
+	list, err := ListSnapshots(dir)
+	if err != nil {
+		t.Fatalf("list: %s", err)
+	}
+	if len(list) != 2 || list[1] != path || filepath.Base(list[0]) != SnapshotName(time.Unix(1, 0)) {
+		t.Errorf("snapshots after prune = %v", list)
+	}
+	if _, err := os.Stat(filepath.Join(dir, SnapshotName(time.Unix(0, 0))+checksumExt)); !os.IsNotExist(err) {
+		t.Errorf("checksum of pruned snapshot left: %v", err)
+	}
+
+	s.Start(nil)
+	if !s.Running() {
+		t.Error("scheduler not running after start")
+	}
+	s.Close()
+	if s.Running() {
+		t.Error("scheduler running after close")
+	}
+}
@@ -14,7 +14,7 @@ var usersBucket = []byte("users")
 var sessionsBucket = []byte("sessions")
 
 // bucketsList for bucket
-var bucketsList = [][]byte{sessionsBucket, usersBucket}
+var bucketsList = [][]byte{metaBucket, sessionsBucket, usersBucket, usersByEmailBucket, userSessionsBucket}
 
 // ErrNoRows for no row in result
 var ErrNoRows = errors.New("db: no rows in result set")
@@ -49,3 +49,17 @@ func (db *DB) CreateAllBuckets() error {
 func TimeNow() time.Time {
 	return time.Now().UTC()
 }
+
+// alive reports whether the background goroutine closing done on exit
+// was started and is still running
+func alive(done chan struct{}) bool {
+	if done == nil {
+		return false
+	}
+	select {
+	case <-done:
+		return false
+	default:
+		return true
+	}
+}
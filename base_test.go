@@ -0,0 +1,25 @@
+package base
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// newTestDB return a db with every bucket, backed by a temp bolt file
+// removed at the end of the test
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	boltdb, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("open db: %s", err)
+	}
+	db := &DB{DB: boltdb}
+	t.Cleanup(func() { db.Close() })
+	if err := db.CreateAllBuckets(); err != nil {
+		t.Fatalf("create buckets: %s", err)
+	}
+	return db
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Access log formats
+const (
+	accessLogCommon   = "common"
+	accessLogCombined = "combined"
+	accessLogJSON     = "json"
+	accessLogOff      = "off"
+)
+
+// clfTime is the time layout of the Common Log Format
+const clfTime = "02/Jan/2006:15:04:05 -0700"
+
+// accessLogger writes one line per request in the Common Log Format, the
+// Combined Log Format or JSON. Every format carries the request ID, the
+// text formats as a trailing field that standard tools ignore.
+type accessLogger struct {
+	mu     sync.Mutex
+	format string
+	out    io.Writer
+}
+
+// accessEntry is a JSON access log line
+type accessEntry struct {
+	Time      string  `json:"time"`
+	RequestID string  `json:"request_id,omitempty"`
+	Remote    string  `json:"remote"`
+	Method    string  `json:"method"`
+	Path      string  `json:"path"`
+	Proto     string  `json:"proto"`
+	Status    int     `json:"status"`
+	Bytes     int     `json:"bytes"`
+	Duration  float64 `json:"duration_ms"`
+	Referer   string  `json:"referer,omitempty"`
+	UserAgent string  `json:"user_agent,omitempty"`
+}
+
+// newAccessLogger return an access logger writing to out in format
+func newAccessLogger(out io.Writer, format string) (*accessLogger, error) {
+	l := &accessLogger{out: out}
+	if err := l.SetFormat(format); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// SetFormat changes the format of the next lines
+func (l *accessLogger) SetFormat(format string) error {
+	switch format = strings.ToLower(format); format {
+	case accessLogCommon, accessLogCombined, accessLogJSON, accessLogOff:
+		l.mu.Lock()
+		l.format = format
+		l.mu.Unlock()
+		return nil
+	}
+	return fmt.Errorf("invalid access log format %q", format)
+}
+
+// Log writes the access log line of a request started at start
+func (l *accessLogger) Log(req *http.Request, rw ResponseWriter, start time.Time) {
+	l.mu.Lock()
+	format := l.format
+	l.mu.Unlock()
+	if format == accessLogOff {
+		return
+	}
+
+	var line []byte
+	switch format {
+	case accessLogJSON:
+		line, _ = json.Marshal(accessEntry{
+			Time:      start.UTC().Format(time.RFC3339),
+			RequestID: getRequestID(req),
+			Remote:    remoteHost(req),
+			Method:    req.Method,
+			Path:      req.URL.RequestURI(),
+			Proto:     req.Proto,
+			Status:    rw.Status(),
+			Bytes:     rw.Size(),
+			Duration:  float64(time.Since(start).Microseconds()) / 1000,
+			Referer:   req.Referer(),
+			UserAgent: req.UserAgent(),
+		})
+	default:
+		s := fmt.Sprintf("%s - - [%s] %q %d %s",
+			remoteHost(req), start.Format(clfTime),
+			req.Method+" "+req.URL.RequestURI()+" "+req.Proto,
+			rw.Status(), clfBytes(rw.Size()))
+		if format == accessLogCombined {
+			s += fmt.Sprintf(" %q %q", req.Referer(), req.UserAgent())
+		}
+		line = []byte(s + " " + clfField(getRequestID(req)))
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	l.out.Write(line)
+	l.mu.Unlock()
+}
+
+// remoteHost return the client address of req without its port
+func remoteHost(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// clfField formats an optional field, "-" when it is empty
+func clfField(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// clfBytes formats a body size, "-" when the body is empty
+func clfBytes(n int) string {
+	if n == 0 {
+		return "-"
+	}
+	return fmt.Sprint(n)
+}
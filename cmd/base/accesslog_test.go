@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessLogRequestID(t *testing.T) {
+	for _, format := range []string{accessLogCommon, accessLogCombined, accessLogJSON} {
+		var out bytes.Buffer
+		l, err := newAccessLogger(&out, format)
+		if err != nil {
+			t.Fatalf("new %s logger: %s", format, err)
+		}
+		req := httptest.NewRequest("GET", "/me?x=1", nil)
+		req = req.WithContext(context.WithValue(req.Context(), requestIDKey, "abc-123"))
+		rw := NewResponseWriter(httptest.NewRecorder())
+		rw.WriteHeader(204)
+		l.Log(req, rw, time.Now())
+
+		line := strings.TrimSpace(out.String())
+		if format == accessLogJSON {
+			var e accessEntry
+			if err := json.Unmarshal([]byte(line), &e); err != nil || e.RequestID != "abc-123" || e.Status != 204 {
+				t.Errorf("json line = %s, %v", line, err)
+			}
+			continue
+		}
+		if !strings.HasSuffix(line, " abc-123") || !strings.Contains(line, `"GET /me?x=1 HTTP/1.1" 204 -`) {
+			t.Errorf("%s line = %s", format, line)
+		}
+	}
+}
+
+func TestAccessLogWithoutRequestID(t *testing.T) {
+	var out bytes.Buffer
+	l, _ := newAccessLogger(&out, accessLogCommon)
+	l.Log(httptest.NewRequest("GET", "/", nil), NewResponseWriter(httptest.NewRecorder()), time.Now())
+	if line := strings.TrimSpace(out.String()); !strings.HasSuffix(line, " -") {
+		t.Errorf("line = %s", line)
+	}
+
+	out.Reset()
+	if err := l.SetFormat(accessLogOff); err != nil {
+		t.Fatalf("set format: %s", err)
+	}
+	l.Log(httptest.NewRequest("GET", "/", nil), NewResponseWriter(httptest.NewRecorder()), time.Now())
+	if out.Len() != 0 {
+		t.Errorf("off logger wrote %q", out.String())
+	}
+	if err := l.SetFormat("nope"); err == nil {
+		t.Error("set unknown format did not fail")
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/rand"
+	"net/http"
+	"sync"
+
+	"base"
+)
+
+// registerRequest is the request body of register
+type registerRequest struct {
+	Email    string `json:"email" validate:"required,email,max=254"`
+	Password string `json:"password" validate:"required,min=8,max=128"`
+	Name     string `json:"name" validate:"max=100"`
+}
+
+// loginRequest is the request body of login
+type loginRequest struct {
+	Email    string `json:"email" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// startSession replaces the request session with a new one for u and
+// sets the session cookie
+func (a *App) startSession(w http.ResponseWriter, req *http.Request, u *base.User) error {
+	s, err := a.sessions.Regenerate(getSession(req), u.ID)
+	if err != nil {
+		return newSessionSaveError(err)
+	}
+	http.SetCookie(w, a.sessions.Cookie(s))
+	return nil
+}
+
+// RegisterHandler creates a user account and logs it in
+func (a *App) RegisterHandler(db *base.DB) HandlerWithError {
+	return func(w http.ResponseWriter, req *http.Request) error {
+		var c registerRequest
+		if err := Bind(req, &c); err != nil {
+			return err
+		}
+		u := &base.User{Email: c.Email, Name: c.Name}
+		err := db.Users().Create(u, c.Password)
+		switch err {
+		case nil:
+		case base.ErrDuplicateRow:
+			return newAPIError(409, "email is already registered", nil).WithCode("email_taken")
+		case base.ErrEmptyEmail, base.ErrEmptyPassword:
+			return newAPIError(400, "invalid registration", err).WithCode("invalid_registration")
+		default:
+			return newError(500, "error when creating user", err)
+		}
+		if err := a.startSession(w, req, u); err != nil {
+			return err
+		}
+		if loc, err := a.router.URL("me"); err == nil {
+			w.Header().Set("Location", loc)
+		}
+		return a.rndr.JSON(w, http.StatusCreated, u)
+	}
+}
+
+// dummyUser return a user with a random password, hashed like the stored
+// ones, to check passwords of unknown emails against
+var dummyUser = sync.OnceValue(func() *base.User {
+	u := &base.User{}
+	if err := u.SetPassword(rand.Text()); err != nil {
+		panic(err)
+	}
+	return u
+})
+
+// LoginHandler checks the credentials and starts a new session
+func (a *App) LoginHandler(db *base.DB) HandlerWithError {
+	return func(w http.ResponseWriter, req *http.Request) error {
+		var c loginRequest
+		if err := Bind(req, &c); err != nil {
+			return err
+		}
+		u, err := db.Users().GetByEmail(c.Email)
+		if err != nil && err != base.ErrNoRows {
+			return newError(500, "error when loading user", err)
+		}
+		if u == nil {
+			// Spend the same hashing time as for a known email so response
+			// times do not reveal which emails are registered
+			dummyUser().CheckPassword(c.Password)
+			return newAPIError(401, "invalid email or password", nil).WithCode("invalid_credentials")
+		}
+		if !u.CheckPassword(c.Password) {
+			return newAPIError(401, "invalid email or password", nil).WithCode("invalid_credentials")
+		}
+		if err := a.startSession(w, req, u); err != nil {
+			return err
+		}
+		return a.rndr.JSON(w, http.StatusOK, u)
+	}
+}
+
+// LogoutHandler deletes the current session, if any, and clears the cookie.
+// It does not require a user, so a stale or expired cookie is cleared too.
+func (a *App) LogoutHandler(db *base.DB) HandlerWithError {
+	return func(w http.ResponseWriter, req *http.Request) error {
+		if s := getSession(req); s != nil {
+			if err := a.sessions.Delete(s.ID); err != nil {
+				return newSessionSaveError(err)
+			}
+		}
+		http.SetCookie(w, a.sessions.ExpiredCookie())
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+}
+
+// MeHandler return the authenticated user
+func (a *App) MeHandler(db *base.DB) HandlerWithError {
+	return func(w http.ResponseWriter, req *http.Request) error {
+		return a.rndr.JSON(w, http.StatusOK, getUser(req))
+	}
+}
+
+// UserListHandler return a page of users ordered by ID
+func (a *App) UserListHandler(db *base.DB) HandlerWithError {
+	return func(w http.ResponseWriter, req *http.Request) error {
+		q, err := pageQuery(req)
+		if err != nil {
+			return err
+		}
+		users, page, err := db.Users().Query(q)
+		if err != nil {
+			return pageError(err)
+		}
+		return a.writePage(w, req, users, page)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"base"
+)
+
+// serve sends a request with a JSON body and the cookie, if any, to the
+// routes of a
+func serve(a *App, method, path, body string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", mediaJSON)
+	req.Header.Set("Accept", mediaJSON)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	a.router.ServeHTTP(w, req)
+	return w
+}
+
+// sessionCookie return the session cookie set by the response, or nil
+func sessionCookie(w *httptest.ResponseRecorder) *http.Cookie {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == base.DefaultSessionCookieName {
+			return c
+		}
+	}
+	return nil
+}
+
+// problemCode return the code of the problem in the response body
+func problemCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var p Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode problem %q: %s", w.Body, err)
+	}
+	return p.Code
+}
+
+const registerBody = `{"email": "a@example.com", "password": "password1", "name": "A"}`
+
+func TestRegister(t *testing.T) {
+	a, _ := newTestApp(t)
+
+	w := serve(a, "POST", "/register", registerBody, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register = %d %s", w.Code, w.Body)
+	}
+	if sessionCookie(w) == nil {
+		t.Error("register set no session cookie")
+	}
+	if loc := w.Header().Get("Location"); loc != "/me" {
+		t.Errorf("Location = %q, want /me", loc)
+	}
+	if strings.Contains(w.Body.String(), "password") {
+		t.Errorf("register response exposes the password: %s", w.Body)
+	}
+
+	for _, email := range []string{"a@example.com", "A@Example.com"} {
+		w = serve(a, "POST", "/register", strings.Replace(registerBody, "a@example.com", email, 1), nil)
+		if w.Code != http.StatusConflict || problemCode(t, w) != "email_taken" {
+			t.Errorf("register %s again = %d %s", email, w.Code, w.Body)
+		}
+	}
+
+	w = serve(a, "POST", "/register", `{"email": "b@example.com", "password": "short"}`, nil)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("register with a short password = %d %s", w.Code, w.Body)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	a, _ := newTestApp(t)
+	registered := sessionCookie(serve(a, "POST", "/register", registerBody, nil))
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"wrong password", `{"email": "a@example.com", "password": "password2"}`},
+		{"unknown email", `{"email": "b@example.com", "password": "password1"}`},
+	}
+	for _, tt := range tests {
+		w := serve(a, "POST", "/login", tt.body, nil)
+		if w.Code != http.StatusUnauthorized || problemCode(t, w) != "invalid_credentials" {
+			t.Errorf("%s: login = %d %s", tt.name, w.Code, w.Body)
+		}
+		if sessionCookie(w) != nil {
+			t.Errorf("%s: login set a session cookie", tt.name)
+		}
+	}
+
+	// Login rotates the session: the cookie of the session in use before
+	// is no longer valid
+	w := serve(a, "POST", "/login", `{"email": "a@example.com", "password": "password1"}`, registered)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login = %d %s", w.Code, w.Body)
+	}
+	fresh := sessionCookie(w)
+	if fresh == nil || fresh.Value == registered.Value {
+		t.Fatalf("login cookie = %v, want a new session", fresh)
+	}
+	if w := serve(a, "GET", "/me", "", registered); w.Code != http.StatusUnauthorized {
+		t.Errorf("me with the session before login = %d", w.Code)
+	}
+	w = serve(a, "GET", "/me", "", fresh)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "a@example.com") {
+		t.Errorf("me = %d %s", w.Code, w.Body)
+	}
+}
+
+func TestMeRequiresAuth(t *testing.T) {
+	a, _ := newTestApp(t)
+	w := serve(a, "GET", "/me", "", nil)
+	if w.Code != http.StatusUnauthorized || problemCode(t, w) != "authentication_required" {
+		t.Errorf("me without session = %d %s", w.Code, w.Body)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	a, _ := newTestApp(t)
+	cookie := sessionCookie(serve(a, "POST", "/register", registerBody, nil))
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+	}{
+		{"session", cookie},
+		{"deleted session", cookie},
+		{"forged cookie", &http.Cookie{Name: base.DefaultSessionCookieName, Value: "forged"}},
+		{"no cookie", nil},
+	}
+	for _, tt := range tests {
+		w := serve(a, "POST", "/logout", "", tt.cookie)
+		if w.Code != http.StatusNoContent {
+			t.Errorf("%s: logout = %d %s", tt.name, w.Code, w.Body)
+		}
+		if c := sessionCookie(w); c == nil || c.MaxAge >= 0 || c.Value != "" {
+			t.Errorf("%s: logout cookie = %v, want it cleared", tt.name, c)
+		}
+	}
+	if w := serve(a, "GET", "/me", "", cookie); w.Code != http.StatusUnauthorized {
+		t.Errorf("me after logout = %d", w.Code)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"base"
+)
+
+// loadSession return the request with its session and user, if any, stored
+// in the context. The request is returned unchanged when it has no valid
+// session.
+func (a *App) loadSession(req *http.Request) *http.Request {
+	s, err := a.sessions.Load(req)
+	if err != nil {
+		if err != base.ErrNoRows && err != base.ErrInvalidCookie {
+			a.log(req).Error("error on loading session", "err", err)
+		}
+		return req
+	}
+	ctx := context.WithValue(req.Context(), sessionKey, s)
+	if s.UserID != 0 {
+		u, err := a.db.Users().GetByID(s.UserID)
+		switch {
+		case err == nil:
+			ctx = context.WithValue(ctx, userKey, u)
+			ctx = withLogger(ctx, a.log(req).With("user_id", u.ID))
+		case err != base.ErrNoRows:
+			a.log(req).Error("error on loading user", "user_id", s.UserID, "err", err)
+		}
+	}
+	return req.WithContext(ctx)
+}
+
+// optionalAuth middleware loads the current user, if any, into the request
+func (a *App) optionalAuth(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, req *http.Request) {
+		next.ServeHTTP(w, a.loadSession(req))
+	}
+	return http.HandlerFunc(fn)
+}
+
+// requireAuth middleware loads the current user into the request and
+// rejects the request with 401 when there is none
+func (a *App) requireAuth(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, req *http.Request) {
+		req = a.loadSession(req)
+		if getUser(req) == nil {
+			a.handleError(w, req, newAPIError(http.StatusUnauthorized, "authentication required", nil).WithCode("authentication_required"))
+			return
+		}
+		next.ServeHTTP(w, req)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// getUser return the authenticated user of the request or nil
+func getUser(req *http.Request) *base.User {
+	u, _ := req.Context().Value(userKey).(*base.User)
+	return u
+}
+
+// getSession return the session of the request or nil
+func getSession(req *http.Request) *base.Session {
+	s, _ := req.Context().Value(sessionKey).(*base.Session)
+	return s
+}
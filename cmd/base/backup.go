@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/spf13/pflag"
+
+	"base"
+)
+
+// defaultBackupRetain is how many scheduled snapshots are kept when
+// backupRetain is not configured
+const defaultBackupRetain = 7
+
+// snapshotSumHeader carries the hex SHA-256 of a streamed snapshot
+const snapshotSumHeader = "X-Snapshot-SHA256"
+
+const backupUsage = `usage: base backup [--out FILE]
+
+Write a consistent snapshot of the database and its .sha256 checksum.
+`
+
+const restoreUsage = `usage: base restore [--force] [--no-checksum] FILE
+
+Verify the snapshot FILE against FILE.sha256 and replace the database with
+it. The server must be stopped. The current database is kept as
+base.db.pre-restore. For a snapshot downloaded from /admin/backup, write
+FILE.sha256 from its X-Snapshot-SHA256 header.
+`
+
+// requireAdmin middleware rejects requests without the configured admin
+// token in the Authorization header. Admin routes are hidden when no token
+// is configured.
+func (a *App) requireAdmin(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, req *http.Request) {
+		token := a.cfg().AdminToken
+		if token == "" {
+			a.handleError(w, req, newAPIError(http.StatusNotFound, "not found", nil))
+			return
+		}
+		got := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			a.handleError(w, req, newAPIError(http.StatusUnauthorized, "admin token required", nil).WithCode("admin_token_required"))
+			return
+		}
+		next.ServeHTTP(w, req)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// BackupHandler streams a consistent snapshot of the database with its
+// SHA-256 in the X-Snapshot-SHA256 header. The size, the checksum and the
+// content come from the same read transaction, so a concurrent write
+// cannot make the headers disagree with the body. backupTimeout replaces
+// the server write timeout and bounds how long a slow client holds the
+// read transaction.
+func (a *App) BackupHandler(db *base.DB) HandlerWithError {
+	return func(w http.ResponseWriter, req *http.Request) error {
+		name := base.SnapshotName(base.TimeNow())
+		var deadline time.Time
+		if d := a.cfg().BackupTimeout; d > 0 {
+			deadline = time.Now().Add(d)
+		}
+		if err := http.NewResponseController(w).SetWriteDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return newError(500, "error when setting the backup deadline", err)
+		}
+		err := db.View(func(tx *bolt.Tx) error {
+			h := sha256.New()
+			if _, err := tx.WriteTo(h); err != nil {
+				return err
+			}
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+			w.Header().Set("Content-Length", strconv.FormatInt(tx.Size(), 10))
+			w.Header().Set(snapshotSumHeader, hex.EncodeToString(h.Sum(nil)))
+			// Headers are already sent, so a failure can only be logged
+			if _, err := tx.WriteTo(w); err != nil {
+				a.log(req).Error("error on streaming backup", "err", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return newError(500, "error when reading database", err)
+		}
+		return nil
+	}
+}
+
+// startSnapshots starts the snapshot scheduler when backupInterval is set
+func (a *App) startSnapshots() error {
+	if a.snapshots == nil {
+		return nil
+	}
+	a.snapshots.Start(func(err error) {
+		a.logr.Error("error on scheduled snapshot", "err", err)
+	})
+	return nil
+}
+
+// stopSnapshots waits for a running snapshot before the db is closed
+func (a *App) stopSnapshots(ctx context.Context) error {
+	if a.snapshots != nil {
+		a.snapshots.Close()
+	}
+	return nil
+}
+
+// runBackup runs the backup command and return the process exit code
+func runBackup(pwd string, args []string) int {
+	fs := pflag.NewFlagSet("backup", pflag.ContinueOnError)
+	out := fs.StringP("out", "o", base.SnapshotName(base.TimeNow()), "snapshot file to write")
+	commandFlags(fs, pwd)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, backupUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsageError
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return exitUsageError
+	}
+
+	db, code := openCommandDB(pwd, fs, false)
+	if db == nil {
+		return code
+	}
+	defer closeDB(db)
+	sum, err := db.SnapshotToFile(*out)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error on writing snapshot: %s\n", err)
+		return exitCommandError
+	}
+	fmt.Printf("%s  %s\n", sum, *out)
+	return exitOK
+}
+
+// runRestore runs the restore command and return the process exit code
+func runRestore(pwd string, args []string) int {
+	fs := pflag.NewFlagSet("restore", pflag.ContinueOnError)
+	force := fs.Bool("force", false, "restore without keeping the current database")
+	noChecksum := fs.Bool("no-checksum", false, "restore a snapshot without a FILE.sha256 checksum file")
+	commandFlags(fs, pwd)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, restoreUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsageError
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsageError
+	}
+	src := fs.Arg(0)
+	config, err := commandConfig(pwd, fs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsageError
+	}
+	dbPath := config.DBPath
+
+	// Holding the file lock until the database is replaced makes sure no
+	// server is using it, nor starts to
+	if _, err := os.Stat(dbPath); err == nil {
+		boltdb, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: time.Second})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "database %s is in use, stop the server first: %s\n", dbPath, err)
+			return exitCommandError
+		}
+		defer boltdb.Close()
+	}
+
+	keep := dbPath + ".pre-restore"
+	if *force {
+		keep = ""
+	}
+	if err := base.RestoreSnapshot(src, dbPath, *noChecksum, keep); err != nil {
+		fmt.Fprintf(os.Stderr, "error on restoring %s: %s\n", src, err)
+		return exitCommandError
+	}
+	fmt.Printf("restored %s to %s\n", src, dbPath)
+	return exitOK
+}
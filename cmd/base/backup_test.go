@@ -0,0 +1,42 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"base"
+)
+
+func TestBackupHandlerSendsChecksum(t *testing.T) {
+	boltdb, err := bolt.Open(filepath.Join(t.TempDir(), "base.db"), 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := &base.DB{DB: boltdb}
+	defer db.Close()
+	if err := db.CreateAllBuckets(); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	a := &App{}
+	a.config.Store(&baseConfig{BackupTimeout: time.Minute})
+	if err := a.BackupHandler(db)(w, httptest.NewRequest("GET", "/admin/backup", nil)); err != nil {
+		t.Fatalf("backup: %s", err)
+	}
+	body := w.Body.Bytes()
+	sum := sha256.Sum256(body)
+	if got := w.Header().Get(snapshotSumHeader); got != hex.EncodeToString(sum[:]) {
+		t.Errorf("%s = %q, want the SHA-256 of the body", snapshotSumHeader, got)
+	}
+	if got := w.Header().Get("Content-Length"); got != strconv.Itoa(len(body)) {
+		t.Errorf("Content-Length = %s, body has %d bytes", got, len(body))
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// maxBodySize is the largest request body Bind accepts
+const maxBodySize = 1 << 20
+
+// regexCache holds the compiled patterns of regex validation rules
+var regexCache sync.Map
+
+// Bind decodes the JSON request body into dst and validates it against the
+// `validate` struct tags of dst. It requires a JSON Content-Type, limits the
+// body to maxBodySize and rejects unknown fields. Every failing field is
+// reported in a single validation APIError.
+//
+// Supported rules, comma separated: required, min=N, max=N, email,
+// oneof=a b c and regex=PATTERN, which must be the last rule. min and max
+// apply to the length of strings, slices and maps and to the value of
+// numbers, zero included. Other rules are skipped for empty optional
+// fields and every rule is skipped for nil pointers.
+func Bind(req *http.Request, dst interface{}) error {
+	mt, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil || mt != "application/json" {
+		return newAPIError(http.StatusUnsupportedMediaType, "Content-Type must be application/json", nil).WithCode("unsupported_media_type")
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(nil, req.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return bindError(err)
+	}
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		return newAPIError(http.StatusBadRequest, "request body must contain a single JSON value", nil).WithCode("invalid_body")
+	}
+
+	fields, err := validate(dst)
+	if err != nil {
+		return newError(500, "error when validating request", err)
+	}
+	if len(fields) > 0 {
+		return newValidationError(fields)
+	}
+	return nil
+}
+
+// bindError converts a JSON decoding error into an API error
+func bindError(err error) error {
+	var maxErr *http.MaxBytesError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &maxErr):
+		return newAPIError(http.StatusRequestEntityTooLarge, fmt.Sprintf("request body must not be larger than %d bytes", maxErr.Limit), nil).WithCode("body_too_large")
+	case errors.As(err, &typeErr):
+		e := newAPIError(http.StatusBadRequest, "request body has a field of the wrong type", nil).WithCode("invalid_body")
+		e.Fields = []FieldError{{Field: typeErr.Field, Code: "type", Message: "must be " + typeErr.Type.String()}}
+		return e
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		name := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		e := newAPIError(http.StatusBadRequest, "request body has an unknown field", nil).WithCode("invalid_body")
+		e.Fields = []FieldError{{Field: name, Code: "unknown", Message: "is not allowed"}}
+		return e
+	case err == io.EOF:
+		return newAPIError(http.StatusBadRequest, "request body must not be empty", nil).WithCode("invalid_body")
+	default:
+		return newAPIError(http.StatusBadRequest, "request body is not valid JSON", nil).WithCode("invalid_body")
+	}
+}
+
+// validate checks v, a pointer to a struct, against its validate tags.
+// It return an error only for malformed tags.
+func validate(v interface{}) ([]FieldError, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, nil
+	}
+	var fields []FieldError
+	err := validateStruct(rv, "", &fields)
+	return fields, err
+}
+
+func validateStruct(rv reflect.Value, prefix string, fields *[]FieldError) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		name := jsonName(sf)
+		if name == "-" {
+			continue
+		}
+		name = prefix + name
+		fv := rv.Field(i)
+
+		if tag := sf.Tag.Get("validate"); tag != "" {
+			fe, err := validateField(fv, name, tag)
+			if err != nil {
+				return fmt.Errorf("field %s: %s", name, err)
+			}
+			if fe != nil {
+				*fields = append(*fields, *fe)
+				continue
+			}
+		}
+
+		for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+			fv = fv.Elem()
+		}
+		if fv.Kind() == reflect.Struct {
+			if err := validateStruct(fv, name+".", fields); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateField applies the rules of tag to fv and return the first failure
+func validateField(fv reflect.Value, name, tag string) (*FieldError, error) {
+	for fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			break
+		}
+		fv = fv.Elem()
+	}
+	empty := fv.IsZero()
+
+	for tag != "" {
+		var rule string
+		if strings.HasPrefix(tag, "regex=") {
+			rule, tag = tag, ""
+		} else if i := strings.Index(tag, ","); i >= 0 {
+			rule, tag = tag[:i], tag[i+1:]
+		} else {
+			rule, tag = tag, ""
+		}
+		key, arg, _ := strings.Cut(rule, "=")
+
+		if key == "required" {
+			if empty {
+				return &FieldError{Field: name, Code: "required", Message: "is required"}, nil
+			}
+			continue
+		}
+		// A zero number is a value, not an omitted field, so its bounds
+		// still apply. Nil pointers are omitted and skip every rule.
+		if empty && !(isNumber(fv) && (key == "min" || key == "max")) {
+			continue
+		}
+
+		switch key {
+		case "min", "max":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad %s argument %q", key, arg)
+			}
+			n, isLen, ok := measure(fv)
+			if !ok {
+				return nil, fmt.Errorf("%s does not apply to %s", key, fv.Kind())
+			}
+			if (key == "min" && n < limit) || (key == "max" && n > limit) {
+				return &FieldError{Field: name, Code: key, Message: boundMessage(key, arg, isLen)}, nil
+			}
+		case "email":
+			s := fv.String()
+			if a, err := mail.ParseAddress(s); err != nil || a.Address != s {
+				return &FieldError{Field: name, Code: "email", Message: "must be a valid email address"}, nil
+			}
+		case "oneof":
+			s := fmt.Sprint(fv.Interface())
+			allowed := strings.Fields(arg)
+			if !contains(allowed, s) {
+				return &FieldError{Field: name, Code: "oneof", Message: "must be one of " + strings.Join(allowed, ", ")}, nil
+			}
+		case "regex":
+			re, err := compileRegex(arg)
+			if err != nil {
+				return nil, err
+			}
+			if !re.MatchString(fmt.Sprint(fv.Interface())) {
+				return &FieldError{Field: name, Code: "regex", Message: "must match " + arg}, nil
+			}
+		default:
+			return nil, fmt.Errorf("unknown validation rule %q", key)
+		}
+	}
+	return nil, nil
+}
+
+// measure return the length of strings, slices and maps or the value of
+// numbers, for min and max rules
+func measure(fv reflect.Value) (float64, bool, bool) {
+	switch fv.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(fv.String())), true, true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(fv.Len()), true, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(fv.Int()), false, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(fv.Uint()), false, true
+	case reflect.Float32, reflect.Float64:
+		return fv.Float(), false, true
+	}
+	return 0, false, false
+}
+
+// isNumber reports whether fv holds an integer or a float
+func isNumber(fv reflect.Value) bool {
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func boundMessage(key, arg string, isLen bool) string {
+	word := "at least"
+	if key == "max" {
+		word = "at most"
+	}
+	if isLen {
+		return fmt.Sprintf("must have %s %s characters or items", word, arg)
+	}
+	return fmt.Sprintf("must be %s %s", word, arg)
+}
+
+// compileRegex return the compiled pattern, anchored to the whole value
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("bad regex %q: %s", pattern, err)
+	}
+	regexCache.Store(pattern, re)
+	return re, nil
+}
+
+// jsonName return the JSON name of a struct field
+func jsonName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" {
+		return sf.Name
+	}
+	return name
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type bindAddress struct {
+	City string `json:"city" validate:"required"`
+}
+
+type bindRequest struct {
+	Name    string       `json:"name" validate:"required,max=5"`
+	Email   string       `json:"email" validate:"email"`
+	Age     int          `json:"age" validate:"min=1,max=130"`
+	Score   *float64     `json:"score" validate:"min=0.5"`
+	Role    string       `json:"role" validate:"oneof=admin user"`
+	Code    string       `json:"code" validate:"regex=[A-Z]{2},[0-9]"`
+	Tags    []string     `json:"tags" validate:"max=2"`
+	Address *bindAddress `json:"address"`
+}
+
+// bindFields return the validation failures of body as field:code pairs
+func bindFields(t *testing.T, body string) map[string]string {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	err := Bind(req, &bindRequest{})
+	if err == nil {
+		return nil
+	}
+	var ae *APIError
+	if !errors.As(err, &ae) || ae.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("bind %s = %v, want a validation error", body, err)
+	}
+	fields := map[string]string{}
+	for _, f := range ae.Fields {
+		fields[f.Field] = f.Code
+	}
+	return fields
+}
+
+func TestBindValid(t *testing.T) {
+	body := `{"name":"ann","email":"ann@example.com","age":30,"score":1,"role":"user","code":"AB,1","tags":["a"],"address":{"city":"Oslo"}}`
+	if fields := bindFields(t, body); fields != nil {
+		t.Errorf("bind valid body = %v", fields)
+	}
+	// Optional fields may be omitted, a nil pointer skips its rules
+	if fields := bindFields(t, `{"name":"ann","age":1}`); fields != nil {
+		t.Errorf("bind minimal body = %v", fields)
+	}
+}
+
+func TestBindRules(t *testing.T) {
+	tests := []struct {
+		body, field, code string
+	}{
+		{`{"age":1}`, "name", "required"},
+		{`{"name":"toolong","age":1}`, "name", "max"},
+		{`{"name":"ann","age":1,"email":"nope"}`, "email", "email"},
+		{`{"name":"ann","age":1,"email":"Ann <ann@example.com>"}`, "email", "email"},
+		{`{"name":"ann","age":131}`, "age", "max"},
+		// A zero number is checked against its bounds
+		{`{"name":"ann","age":0}`, "age", "min"},
+		{`{"name":"ann"}`, "age", "min"},
+		{`{"name":"ann","age":1,"score":0}`, "score", "min"},
+		{`{"name":"ann","age":1,"role":"root"}`, "role", "oneof"},
+		{`{"name":"ann","age":1,"code":"AB,12"}`, "code", "regex"},
+		{`{"name":"ann","age":1,"tags":["a","b","c"]}`, "tags", "max"},
+		{`{"name":"ann","age":1,"address":{}}`, "address.city", "required"},
+	}
+	for _, tt := range tests {
+		fields := bindFields(t, tt.body)
+		if fields[tt.field] != tt.code {
+			t.Errorf("bind %s = %v, want %s:%s", tt.body, fields, tt.field, tt.code)
+		}
+	}
+
+	fields := bindFields(t, `{"name":"","age":0,"role":"x"}`)
+	if len(fields) != 3 {
+		t.Errorf("bind reports %v, want every failing field", fields)
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	tests := []struct {
+		contentType, body string
+		status            int
+		code              string
+	}{
+		{"text/plain", `{}`, 415, "unsupported_media_type"},
+		{"application/json", ``, 400, "invalid_body"},
+		{"application/json", `{"name":`, 400, "invalid_body"},
+		{"application/json", `{"name":"a"} {}`, 400, "invalid_body"},
+		{"application/json", `{"nope":1}`, 400, "invalid_body"},
+		{"application/json", `{"age":"old"}`, 400, "invalid_body"},
+		{"application/json", `{"name":"` + strings.Repeat("a", maxBodySize) + `"}`, 413, "body_too_large"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", tt.contentType)
+		err := Bind(req, &bindRequest{})
+		var ae *APIError
+		if !errors.As(err, &ae) || ae.Code != tt.status || ae.ErrCode != tt.code {
+			t.Errorf("bind %.40s = %v, want %d %s", tt.body, err, tt.status, tt.code)
+		}
+	}
+}
+
+func TestValidateBadTags(t *testing.T) {
+	tests := []interface{}{
+		&struct {
+			N int `validate:"min=x"`
+		}{},
+		&struct {
+			B bool `validate:"max=1"`
+		}{B: true},
+		&struct {
+			S string `validate:"nope"`
+		}{S: "a"},
+		&struct {
+			S string `validate:"regex=("`
+		}{S: "a"},
+	}
+	for _, v := range tests {
+		if _, err := validate(v); err == nil {
+			t.Errorf("validate %#v did not fail", v)
+		}
+	}
+}
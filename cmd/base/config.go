@@ -0,0 +1,475 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// configName is the name of the config file, without extension, looked up
+// in the config paths
+const configName = "base-config"
+
+// envPrefix prefixes the environment variables of the settings
+const envPrefix = "BASE"
+
+// minCookieSecretLen is the shortest cookie secret accepted in production
+const minCookieSecretLen = 32
+
+// redacted replaces secret values when the config is printed
+const redacted = "[redacted]"
+
+// baseConfig holds every setting of the app. Each field is read, from the
+// highest precedence, from its command line flag, its BASE_ environment
+// variable, the config file, then its default.
+//
+// Secret fields may hold a secret reference, see SecretProvider.
+//
+// The mapstructure tag is the config file key, from which the flag name
+// (cookie-secret) and the environment variable (BASE_COOKIE_SECRET) are
+// derived. Fields tagged secret are redacted when printed. Fields tagged
+// reload are applied when the config file changes, changes to the other
+// fields require a restart.
+type baseConfig struct {
+	IsDevelopment     bool          `mapstructure:"isDevelopment" usage:"enable development mode: insecure cookies, a default cookie secret and template reloading"`
+	Port              string        `mapstructure:"port" usage:"port or host:port to listen on"`
+	DBPath            string        `mapstructure:"dbPath" usage:"path of the bolt database"`
+	CookieSecret      string        `mapstructure:"cookieSecret" secret:"true" usage:"secret signing the session cookies"`
+	PrevSecrets       string        `mapstructure:"previousCookieSecrets" secret:"true" usage:"space separated secrets of cookies signed before a rotation"`
+	Keyfile           string        `mapstructure:"keyfile" usage:"encrypted keyfile resolving keyfile: secret references"`
+	SessionExpiry     time.Duration `mapstructure:"sessionExpiry" usage:"session lifetime"`
+	ExpireTime        int           `mapstructure:"expireTime" usage:"deprecated, session lifetime in hours"`
+	ShutdownTimeout   time.Duration `mapstructure:"shutdownTimeout" usage:"time allowed to drain requests on shutdown"`
+	ReadHeaderTimeout time.Duration `mapstructure:"readHeaderTimeout" usage:"time allowed to read the request headers"`
+	ReadTimeout       time.Duration `mapstructure:"readTimeout" usage:"time allowed to read a request, 0 for no limit"`
+	WriteTimeout      time.Duration `mapstructure:"writeTimeout" usage:"time allowed to write a response, 0 for no limit"`
+	IdleTimeout       time.Duration `mapstructure:"idleTimeout" usage:"time a keep-alive connection waits for the next request"`
+	BackupTimeout     time.Duration `mapstructure:"backupTimeout" reload:"true" usage:"time allowed to stream a backup, 0 for no limit"`
+	LogLevel          string        `mapstructure:"logLevel" reload:"true" usage:"log level: debug, info, warn or error"`
+	LogFormat         string        `mapstructure:"logFormat" usage:"log format: logfmt or json"`
+	AccessLogFormat   string        `mapstructure:"accessLogFormat" reload:"true" usage:"access log format: common, combined, json or off"`
+	AdminToken        string        `mapstructure:"adminToken" secret:"true" reload:"true" usage:"bearer token of the admin routes"`
+	BackupDir         string        `mapstructure:"backupDir" usage:"directory of the scheduled snapshots"`
+	BackupInterval    time.Duration `mapstructure:"backupInterval" usage:"interval of the scheduled snapshots, 0 to disable"`
+	BackupRetain      int           `mapstructure:"backupRetain" usage:"number of scheduled snapshots kept"`
+	TemplateDir       string        `mapstructure:"templateDir" usage:"directory of the HTML templates"`
+	TemplateLayout    string        `mapstructure:"templateLayout" usage:"layout wrapping the HTML pages"`
+	SiteName          string        `mapstructure:"siteName" usage:"site name shown on HTML pages"`
+	PrettyJSON        bool          `mapstructure:"prettyJSON" usage:"indent JSON responses"`
+	ErrorReportFile   string        `mapstructure:"errorReportFile" usage:"file receiving error reports"`
+	ErrorReportURL    string        `mapstructure:"errorReportURL" secret:"true" usage:"URL receiving error reports"`
+	MinFreeDisk       int64         `mapstructure:"minFreeDisk" reload:"true" usage:"free bytes required next to the database"`
+
+	// previousSecrets are the resolved PrevSecrets
+	previousSecrets []string
+}
+
+// defaultConfig return the defaults of the settings for an executable in pwd
+func defaultConfig(pwd string) baseConfig {
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "3000"
+	}
+	return baseConfig{
+		Port:              port,
+		DBPath:            path.Join(pwd, "base.db"),
+		SessionExpiry:     defaultSessionExpiry,
+		ShutdownTimeout:   defaultShutdownTimeout,
+		ReadHeaderTimeout: defaultReadHeaderTimeout,
+		ReadTimeout:       defaultReadTimeout,
+		WriteTimeout:      defaultWriteTimeout,
+		IdleTimeout:       defaultIdleTimeout,
+		BackupTimeout:     defaultBackupTimeout,
+		LogLevel:          "info",
+		LogFormat:         logFormatLogfmt,
+		AccessLogFormat:   accessLogCommon,
+		BackupDir:         path.Join(pwd, "backups"),
+		BackupRetain:      defaultBackupRetain,
+		TemplateDir:       path.Join(pwd, "templates"),
+		TemplateLayout:    "base",
+		SiteName:          "base",
+		MinFreeDisk:       defaultMinFreeDisk,
+	}
+}
+
+// configField is a setting of baseConfig
+type configField struct {
+	key    string
+	usage  string
+	secret bool
+	reload bool
+	index  int
+}
+
+// configFields return the settings of baseConfig in declaration order
+func configFields() []configField {
+	t := reflect.TypeOf(baseConfig{})
+	fields := make([]configField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Tag.Get("mapstructure") == "" {
+			continue
+		}
+		fields = append(fields, configField{
+			key:    sf.Tag.Get("mapstructure"),
+			usage:  sf.Tag.Get("usage"),
+			secret: sf.Tag.Get("secret") == "true",
+			reload: sf.Tag.Get("reload") == "true",
+			index:  i,
+		})
+	}
+	return fields
+}
+
+// flagName return the command line flag of a key, e.g. cookie-secret
+func (f configField) flagName() string {
+	return strings.Join(splitWords(f.key), "-")
+}
+
+// envName return the environment variable of a key, e.g. BASE_COOKIE_SECRET
+func (f configField) envName() string {
+	return envPrefix + "_" + strings.ToUpper(strings.Join(splitWords(f.key), "_"))
+}
+
+// splitWords splits a camelCase key into lower case words
+func splitWords(key string) []string {
+	var words []string
+	start := 0
+	for i, c := range key {
+		if i > 0 && unicode.IsUpper(c) && !unicode.IsUpper(rune(key[i-1])) {
+			words = append(words, strings.ToLower(key[start:i]))
+			start = i
+		}
+	}
+	return append(words, strings.ToLower(key[start:]))
+}
+
+// configFlags adds the --config flag and a flag per setting to fs
+func configFlags(fs *pflag.FlagSet, pwd string) {
+	def := reflect.ValueOf(defaultConfig(pwd))
+	fs.String("config", "", "config file, $"+envPrefix+"_CONFIG")
+	for _, f := range configFields() {
+		usage := f.usage + ", $" + f.envName()
+		switch v := def.Field(f.index).Interface().(type) {
+		case string:
+			if f.secret {
+				v = ""
+			}
+			fs.String(f.flagName(), v, usage)
+		case bool:
+			fs.Bool(f.flagName(), v, usage)
+		case int:
+			fs.Int(f.flagName(), v, usage)
+		case int64:
+			fs.Int64(f.flagName(), v, usage)
+		case time.Duration:
+			fs.Duration(f.flagName(), v, usage)
+		}
+	}
+}
+
+// LoadConfiguration return the config of the app from, in order of
+// precedence, the flags of fs, the environment, the config file and the
+// defaults. fs may be nil. The config file is the --config flag, or
+// $BASE_CONFIG, or base-config.{json,yaml,toml} in the executable folder
+// pwd or the working directory. A missing config file is not an error.
+func LoadConfiguration(pwd string, fs *pflag.FlagSet) (baseConfig, error) {
+	if err := readConfiguration(pwd, fs); err != nil {
+		return baseConfig{}, err
+	}
+	return decodeConfig()
+}
+
+// readConfiguration sets up viper with the config sources, see
+// LoadConfiguration, without decoding the config
+func readConfiguration(pwd string, fs *pflag.FlagSet) error {
+	def := reflect.ValueOf(defaultConfig(pwd))
+	for _, f := range configFields() {
+		viper.SetDefault(f.key, def.Field(f.index).Interface())
+		if err := viper.BindEnv(f.key, f.envName()); err != nil {
+			return err
+		}
+		if fs != nil {
+			if fl := fs.Lookup(f.flagName()); fl != nil {
+				if err := viper.BindPFlag(f.key, fl); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	boundFlags = fs
+
+	configFile := os.Getenv(envPrefix + "_CONFIG")
+	if fs != nil {
+		if fl := fs.Lookup("config"); fl != nil && fl.Changed {
+			configFile = fl.Value.String()
+		}
+	}
+	if configFile != "" {
+		viper.SetConfigFile(configFile)
+	} else {
+		viper.SetConfigName(configName)
+		viper.AddConfigPath(pwd)
+		viper.AddConfigPath(".")
+	}
+	if err := viper.ReadInConfig(); err != nil {
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok || configFile != "" {
+			return fmt.Errorf("cannot read config file: %s", err)
+		}
+	}
+	return nil
+}
+
+// boundFlags is the flag set bound by readConfiguration, it may be nil
+var boundFlags *pflag.FlagSet
+
+// isSet reports whether the setting key is set by its flag, its
+// environment variable or the config file. Unlike viper.IsSet, a default
+// does not count.
+func isSet(key string) bool {
+	f := configField{key: key}
+	if boundFlags != nil {
+		if fl := boundFlags.Lookup(f.flagName()); fl != nil && fl.Changed {
+			return true
+		}
+	}
+	if os.Getenv(f.envName()) != "" {
+		return true
+	}
+	return viper.InConfig(key) || viper.InConfig(strings.ToLower(key))
+}
+
+// decodeConfig return the validated config from the current viper settings
+func decodeConfig() (baseConfig, error) {
+	var c baseConfig
+	if err := viper.Unmarshal(&c); err != nil {
+		return baseConfig{}, fmt.Errorf("cannot decode config: %s", err)
+	}
+	// expireTime predates sessionExpiry and is honoured when it is the only one set
+	if c.ExpireTime > 0 && !isSet("sessionExpiry") {
+		c.SessionExpiry = time.Duration(c.ExpireTime) * time.Hour
+	}
+	if err := c.resolveSecrets(); err != nil {
+		return baseConfig{}, err
+	}
+	if c.CookieSecret == "" && c.IsDevelopment {
+		c.CookieSecret = developmentCookieSecret
+	}
+	if err := c.validate(); err != nil {
+		return baseConfig{}, err
+	}
+	return c, nil
+}
+
+// resolveSecrets replaces the secret references of the secret settings
+// with the secrets
+func (c *baseConfig) resolveSecrets() error {
+	providers := secretProviders(c.Keyfile)
+	v := reflect.ValueOf(c).Elem()
+	for _, f := range configFields() {
+		fv := v.Field(f.index)
+		if !f.secret || fv.Kind() != reflect.String {
+			continue
+		}
+		if f.key == "previousCookieSecrets" {
+			c.previousSecrets = nil
+			for _, ref := range strings.Fields(c.PrevSecrets) {
+				s, err := resolveSecret(providers, ref)
+				if err != nil {
+					return fmt.Errorf("cannot resolve %s: %s", f.key, err)
+				}
+				c.previousSecrets = append(c.previousSecrets, s)
+			}
+			continue
+		}
+		s, err := resolveSecret(providers, fv.String())
+		if err != nil {
+			return fmt.Errorf("cannot resolve %s: %s", f.key, err)
+		}
+		fv.SetString(s)
+	}
+	return nil
+}
+
+// previousCookieSecrets return the secrets of cookies signed before a rotation
+func (c baseConfig) previousCookieSecrets() [][]byte {
+	secrets := make([][]byte, len(c.previousSecrets))
+	for i, s := range c.previousSecrets {
+		secrets[i] = []byte(s)
+	}
+	return secrets
+}
+
+// configError lists every invalid setting
+type configError []string
+
+// Error allows configError to satisfy the error interface
+func (ce configError) Error() string {
+	return "invalid config:\n  " + strings.Join(ce, "\n  ")
+}
+
+// validate return a configError listing every invalid setting
+func (c baseConfig) validate() error {
+	var errs configError
+	fail := func(key, format string, v ...interface{}) {
+		errs = append(errs, key+": "+fmt.Sprintf(format, v...))
+	}
+
+	if !validPort(c.Port) {
+		fail("port", "must be a port number or host:port, got %q", c.Port)
+	}
+	if c.DBPath == "" {
+		fail("dbPath", "is required")
+	}
+	if !c.IsDevelopment {
+		if len(c.CookieSecret) < minCookieSecretLen {
+			fail("cookieSecret", "must have at least %d characters outside development", minCookieSecretLen)
+		}
+		for _, s := range append([]string{c.CookieSecret}, c.previousSecrets...) {
+			if contains(defaultSecrets, s) {
+				fail("cookieSecret", "is a publicly known default secret, set your own outside development")
+				break
+			}
+		}
+	}
+	if c.SessionExpiry <= 0 {
+		fail("sessionExpiry", "must be positive")
+	}
+	if c.ShutdownTimeout < 0 {
+		fail("shutdownTimeout", "must not be negative")
+	}
+	if c.ReadHeaderTimeout <= 0 {
+		fail("readHeaderTimeout", "must be positive")
+	}
+	if c.IdleTimeout <= 0 {
+		fail("idleTimeout", "must be positive")
+	}
+	if c.ReadTimeout < 0 {
+		fail("readTimeout", "must not be negative")
+	}
+	if c.WriteTimeout < 0 {
+		fail("writeTimeout", "must not be negative")
+	}
+	if c.BackupTimeout < 0 {
+		fail("backupTimeout", "must not be negative")
+	}
+	if !contains([]string{"debug", "info", "warn", "error"}, strings.ToLower(c.LogLevel)) {
+		fail("logLevel", "must be one of debug, info, warn, error, got %q", c.LogLevel)
+	}
+	if !contains([]string{logFormatLogfmt, logFormatJSON}, strings.ToLower(c.LogFormat)) {
+		fail("logFormat", "must be one of logfmt, json, got %q", c.LogFormat)
+	}
+	if !contains([]string{accessLogCommon, accessLogCombined, accessLogJSON, accessLogOff}, strings.ToLower(c.AccessLogFormat)) {
+		fail("accessLogFormat", "must be one of common, combined, json, off, got %q", c.AccessLogFormat)
+	}
+	if c.BackupInterval < 0 {
+		fail("backupInterval", "must not be negative")
+	}
+	if c.BackupInterval > 0 && c.BackupDir == "" {
+		fail("backupDir", "is required when backupInterval is set")
+	}
+	if c.BackupRetain < 0 {
+		fail("backupRetain", "must not be negative")
+	}
+	if c.ErrorReportURL != "" {
+		if u, err := url.Parse(c.ErrorReportURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail("errorReportURL", "must be an http or https URL")
+		}
+	}
+	if c.MinFreeDisk < 0 {
+		fail("minFreeDisk", "must not be negative")
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validPort reports whether port is a port number or host:port
+func validPort(port string) bool {
+	if strings.Contains(port, ":") {
+		var err error
+		if _, port, err = net.SplitHostPort(port); err != nil {
+			return false
+		}
+	}
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n < 65536
+}
+
+// Print writes the settings as key = value lines, sorted by key, with
+// secrets redacted
+func (c baseConfig) Print(w io.Writer) error {
+	v := reflect.ValueOf(c)
+	fields := configFields()
+	sort.Slice(fields, func(i, j int) bool { return fields[i].key < fields[j].key })
+	for _, f := range fields {
+		val := fmt.Sprint(v.Field(f.index).Interface())
+		if f.secret && val != "" {
+			val = redacted
+		}
+		if _, err := fmt.Fprintf(w, "%s = %s\n", f.key, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const configUsage = `usage: base config [flags] <command>
+
+commands:
+  check    validate the config, exit with status 4 if it is invalid
+  print    print the config with secrets redacted
+
+The config is read as for serving, so the flags below override it.
+`
+
+// runConfig runs the config command and return the process exit code
+func runConfig(pwd string, args []string) int {
+	fs := pflag.NewFlagSet("config", pflag.ContinueOnError)
+	configFlags(fs, pwd)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, configUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsageError
+	}
+	if fs.NArg() != 1 || (fs.Arg(0) != "check" && fs.Arg(0) != "print") {
+		fs.Usage()
+		return exitUsageError
+	}
+
+	config, err := LoadConfiguration(pwd, fs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsageError
+	}
+	if fs.Arg(0) == "print" {
+		if err := config.Print(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "error on printing config: %s\n", err)
+			return exitCommandError
+		}
+		return exitOK
+	}
+	file := viper.ConfigFileUsed()
+	if file == "" {
+		file = "no config file"
+	}
+	fmt.Printf("config ok (%s)\n", file)
+	return exitOK
+}
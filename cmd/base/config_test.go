@@ -0,0 +1,192 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// loadTestConfig loads the config of an executable in a temporary folder
+// holding the config file content, with the flags args
+func loadTestConfig(t *testing.T, content string, args ...string) (baseConfig, error) {
+	t.Helper()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	dir := t.TempDir()
+	if content != "" {
+		if err := os.WriteFile(filepath.Join(dir, configName+".json"), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	configFlags(fs, dir)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return LoadConfiguration(dir, fs)
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	file := `{"isDevelopment": true, "siteName": "file", "logLevel": "warn", "backupRetain": 3}`
+	tests := []struct {
+		name  string
+		env   map[string]string
+		args  []string
+		site  string
+		level string
+	}{
+		{"file", nil, nil, "file", "warn"},
+		{"env over file", map[string]string{"BASE_SITE_NAME": "env"}, nil, "env", "warn"},
+		{"flag over env", map[string]string{"BASE_SITE_NAME": "env"}, []string{"--site-name", "flag"}, "flag", "warn"},
+		{"flag over file", nil, []string{"--log-level", "debug"}, "file", "debug"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			c, err := loadTestConfig(t, file, tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.SiteName != tt.site || c.LogLevel != tt.level {
+				t.Errorf("siteName, logLevel = %q, %q, want %q, %q", c.SiteName, c.LogLevel, tt.site, tt.level)
+			}
+			if c.BackupRetain != 3 || c.TemplateLayout != "base" {
+				t.Errorf("backupRetain, templateLayout = %d, %q", c.BackupRetain, c.TemplateLayout)
+			}
+		})
+	}
+}
+
+func TestConfigDefaultsValidate(t *testing.T) {
+	c, err := loadTestConfig(t, `{"isDevelopment": true}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ReadHeaderTimeout != defaultReadHeaderTimeout || c.WriteTimeout != defaultWriteTimeout || c.IdleTimeout != defaultIdleTimeout {
+		t.Errorf("server timeouts = %s, %s, %s", c.ReadHeaderTimeout, c.WriteTimeout, c.IdleTimeout)
+	}
+	if _, err := loadTestConfig(t, ""); err == nil || !strings.Contains(err.Error(), "cookieSecret") {
+		t.Errorf("production defaults without a cookie secret = %v", err)
+	}
+}
+
+func TestConfigExpireTime(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		args    []string
+		want    time.Duration
+	}{
+		{"default", `{"isDevelopment": true}`, nil, defaultSessionExpiry},
+		{"legacy only", `{"isDevelopment": true, "expireTime": 2}`, nil, 2 * time.Hour},
+		{"both", `{"isDevelopment": true, "expireTime": 2, "sessionExpiry": "30m"}`, nil, 30 * time.Minute},
+		{"explicit default", `{"isDevelopment": true, "expireTime": 2, "sessionExpiry": "4h"}`, nil, 4 * time.Hour},
+		{"flag", `{"isDevelopment": true, "expireTime": 2}`, []string{"--session-expiry", "4h"}, 4 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := loadTestConfig(t, tt.content, tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.SessionExpiry != tt.want {
+				t.Errorf("sessionExpiry = %s, want %s", c.SessionExpiry, tt.want)
+			}
+		})
+	}
+	t.Run("env", func(t *testing.T) {
+		t.Setenv("BASE_SESSION_EXPIRY", "4h")
+		c, err := loadTestConfig(t, `{"isDevelopment": true, "expireTime": 2}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.SessionExpiry != 4*time.Hour {
+			t.Errorf("sessionExpiry = %s, want 4h", c.SessionExpiry)
+		}
+	})
+}
+
+func TestConfigValidate(t *testing.T) {
+	valid := defaultConfig("/srv/base")
+	valid.CookieSecret = strings.Repeat("s", minCookieSecretLen)
+
+	tests := []struct {
+		name string
+		edit func(c *baseConfig)
+		key  string
+	}{
+		{"valid", func(c *baseConfig) {}, ""},
+		{"port", func(c *baseConfig) { c.Port = "70000" }, "port"},
+		{"host port", func(c *baseConfig) { c.Port = "localhost:80" }, ""},
+		{"dbPath", func(c *baseConfig) { c.DBPath = "" }, "dbPath"},
+		{"short secret", func(c *baseConfig) { c.CookieSecret = "short" }, "cookieSecret"},
+		{"short secret in development", func(c *baseConfig) { c.CookieSecret, c.IsDevelopment = "short", true }, ""},
+		{"sessionExpiry", func(c *baseConfig) { c.SessionExpiry = 0 }, "sessionExpiry"},
+		{"shutdownTimeout", func(c *baseConfig) { c.ShutdownTimeout = -1 }, "shutdownTimeout"},
+		{"readHeaderTimeout", func(c *baseConfig) { c.ReadHeaderTimeout = 0 }, "readHeaderTimeout"},
+		{"readTimeout", func(c *baseConfig) { c.ReadTimeout = -1 }, "readTimeout"},
+		{"no writeTimeout", func(c *baseConfig) { c.WriteTimeout = 0 }, ""},
+		{"writeTimeout", func(c *baseConfig) { c.WriteTimeout = -1 }, "writeTimeout"},
+		{"idleTimeout", func(c *baseConfig) { c.IdleTimeout = 0 }, "idleTimeout"},
+		{"backupTimeout", func(c *baseConfig) { c.BackupTimeout = -1 }, "backupTimeout"},
+		{"logLevel", func(c *baseConfig) { c.LogLevel = "bogus" }, "logLevel"},
+		{"logFormat", func(c *baseConfig) { c.LogFormat = "xml" }, "logFormat"},
+		{"accessLogFormat", func(c *baseConfig) { c.AccessLogFormat = "xml" }, "accessLogFormat"},
+		{"backupDir", func(c *baseConfig) { c.BackupInterval, c.BackupDir = time.Hour, "" }, "backupDir"},
+		{"backupRetain", func(c *baseConfig) { c.BackupRetain = -1 }, "backupRetain"},
+		{"errorReportURL", func(c *baseConfig) { c.ErrorReportURL = "ftp://example.com" }, "errorReportURL"},
+		{"minFreeDisk", func(c *baseConfig) { c.MinFreeDisk = -1 }, "minFreeDisk"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid
+			tt.edit(&c)
+			err := c.validate()
+			if tt.key == "" {
+				if err != nil {
+					t.Errorf("validate = %v", err)
+				}
+				return
+			}
+			ce, ok := err.(configError)
+			if !ok || len(ce) != 1 || !strings.HasPrefix(ce[0], tt.key+": ") {
+				t.Errorf("validate = %v, want an error on %s", err, tt.key)
+			}
+		})
+	}
+}
+
+func TestCommandConfig(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	dir := t.TempDir()
+	t.Chdir(dir)
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	commandFlags(fs, dir)
+	if err := fs.Parse([]string{"--db-path", "other.db"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Production defaults without a cookie secret are enough offline
+	c, err := commandConfig(dir, fs)
+	if err != nil {
+		t.Fatalf("command config: %s", err)
+	}
+	if c.DBPath != "other.db" {
+		t.Errorf("dbPath = %q, want other.db", c.DBPath)
+	}
+	if err := fs.Set("db-path", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := commandConfig(dir, fs); err == nil {
+		t.Error("command config without dbPath did not fail")
+	}
+}
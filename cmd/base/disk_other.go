@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// diskFree is not supported on this platform, the disk check always passes
+func diskFree(dir string) (uint64, error) {
+	return 0, errDiskFreeUnsupported
+}
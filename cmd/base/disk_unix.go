@@ -0,0 +1,16 @@
+//go:build unix
+
+package main
+
+import (
+	"syscall"
+)
+
+// diskFree return the bytes available to the process on the disk of dir
+func diskFree(dir string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
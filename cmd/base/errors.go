@@ -1,10 +1,15 @@
 package main
 
 import (
-	//"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 )
 
+// problemContentType is the media type of RFC 7807 error responses
+const problemContentType = "application/problem+json"
+
 // Error represents a handler error. It provides methods for a HTTP status
 // code and embeds the built-in error interface.
 type Error interface {
@@ -12,13 +17,37 @@ type Error interface {
 	Status() int
 }
 
-// APIError represents a handler api error
+// APIError represents a handler api error. Message is shown to the client
+// as the problem detail, ErrCode is a machine-readable error code.
 type APIError struct {
-	Code    int    `json:"-"`
-	Err     error  `json:"-"`
+	Code    int
+	Err     error
+	Message string
+	ErrCode string
+	Type    string
+	Fields  []FieldError
+}
+
+// FieldError describes why a single request field is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
 	Message string `json:"message"`
 }
 
+// Problem is an RFC 7807 problem details object
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// RequestID correlates the problem with the server logs
+	RequestID string       `json:"request_id,omitempty"`
+	Code      string       `json:"code"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
 // StatusError represent an error with an associated HTTP status code
 type StatusError struct {
 	Code int
@@ -30,6 +59,11 @@ func (se StatusError) Error() string {
 	return se.Err.Error()
 }
 
+// Unwrap return the underlying error
+func (se StatusError) Unwrap() error {
+	return se.Err
+}
+
 // Status returns our HTTP status code.
 func (se StatusError) Status() int {
 	return se.Code
@@ -50,7 +84,24 @@ func newAPIError(code int, msg string, err error) *APIError {
 	if err != nil {
 		return &APIError{Code: code, Err: fmt.Errorf(msg+": %s", err), Message: err.Error()}
 	}
-	return &APIError{Code: code, Err: fmt.Errorf(msg), Message: msg}
+	return &APIError{Code: code, Err: errors.New(msg), Message: msg}
+}
+
+// WithCode sets the machine-readable error code
+func (ae *APIError) WithCode(code string) *APIError {
+	ae.ErrCode = code
+	return ae
+}
+
+// newValidationError create a 422 API error listing every invalid field
+func newValidationError(fields []FieldError) *APIError {
+	return &APIError{
+		Code:    http.StatusUnprocessableEntity,
+		Err:     fmt.Errorf("validation failed on %d field(s)", len(fields)),
+		Message: "request validation failed",
+		ErrCode: "validation_failed",
+		Fields:  fields,
+	}
 }
 
 // newError create new error
@@ -58,7 +109,7 @@ func newError(code int, msg string, err error) *StatusError {
 	if err != nil {
 		return &StatusError{Code: code, Err: fmt.Errorf(msg+": %s", err)}
 	}
-	return &StatusError{Code: code, Err: fmt.Errorf(msg)}
+	return &StatusError{Code: code, Err: errors.New(msg)}
 }
 
 // newSessionSaveError create new session error
@@ -70,3 +121,42 @@ func newSessionSaveError(err error) *StatusError {
 func newRenderErrMsg(err error) string {
 	return fmt.Sprintf("error rendering HTML: %s", err)
 }
+
+// statusCode return the default error code of an HTTP status, e.g. not_found
+func statusCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	return strings.ReplaceAll(strings.ToLower(strings.ReplaceAll(text, "-", " ")), " ", "_")
+}
+
+// newProblem converts a handler error into problem details for req.
+// Only APIError details are shown to the client, other errors only
+// expose their status.
+func newProblem(req *http.Request, err error) *Problem {
+	p := &Problem{Status: http.StatusInternalServerError, Instance: req.URL.Path, RequestID: getRequestID(req)}
+	var ae *APIError
+	var e Error
+	switch {
+	case errors.As(err, &ae):
+		p.Status = ae.Status()
+		p.Detail = ae.Message
+		p.Code = ae.ErrCode
+		p.Type = ae.Type
+		p.Errors = ae.Fields
+	case errors.As(err, &e):
+		p.Status = e.Status()
+	}
+	if p.Status < 400 || p.Status > 599 {
+		p.Status = http.StatusInternalServerError
+	}
+	if p.Code == "" {
+		p.Code = statusCode(p.Status)
+	}
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	p.Title = http.StatusText(p.Status)
+	return p
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewProblem(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Problem
+	}{
+		{"plain error", errors.New("db: disk on fire"),
+			Problem{Type: "about:blank", Title: "Internal Server Error", Status: 500, Code: "internal_server_error"}},
+		{"status error", newError(503, "db is closed", errors.New("bolt: closed")),
+			Problem{Type: "about:blank", Title: "Service Unavailable", Status: 503, Code: "service_unavailable"}},
+		{"wrapped status error", fmt.Errorf("handler: %w", StatusError{Code: 404, Err: errors.New("no such user")}),
+			Problem{Type: "about:blank", Title: "Not Found", Status: 404, Code: "not_found"}},
+		{"api error", newAPIError(409, "email is already registered", nil).WithCode("email_taken"),
+			Problem{Type: "about:blank", Title: "Conflict", Status: 409, Detail: "email is already registered", Code: "email_taken"}},
+		{"api error type", &APIError{Code: 400, Err: errors.New("x"), Message: "bad", Type: "https://example.com/problems/bad"},
+			Problem{Type: "https://example.com/problems/bad", Title: "Bad Request", Status: 400, Detail: "bad", Code: "bad_request"}},
+		{"invalid status", &StatusError{Code: 200, Err: errors.New("not an error status")},
+			Problem{Type: "about:blank", Title: "Internal Server Error", Status: 500, Code: "internal_server_error"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/users/1?x=1", nil)
+			req = req.WithContext(context.WithValue(req.Context(), requestIDKey, "req-1"))
+			tt.want.Instance, tt.want.RequestID = "/users/1", "req-1"
+			got := newProblem(req, tt.err)
+			if fmt.Sprint(*got) != fmt.Sprint(tt.want) {
+				t.Errorf("problem = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidationProblem(t *testing.T) {
+	fields := []FieldError{{Field: "email", Code: "required", Message: "is required"}}
+	p := newProblem(httptest.NewRequest("POST", "/register", nil), newValidationError(fields))
+	if p.Status != 422 || p.Code != "validation_failed" || len(p.Errors) != 1 || p.Errors[0] != fields[0] {
+		t.Errorf("problem = %+v", p)
+	}
+}
+
+func TestHandleErrorBody(t *testing.T) {
+	a, _ := newTestApp(t)
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		detail string
+	}{
+		{"internal", newError(500, "error when loading user", errors.New("bolt: secret path /var/db")), 500, ""},
+		{"panic", &StatusError{Code: 500, Err: &panicError{value: "secret", stack: []byte("stack")}}, 500, ""},
+		{"client", newAPIError(401, "invalid email or password", nil), 401, "invalid email or password"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/me", nil)
+			a.handleError(w, req, tt.err)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, problemContentType) {
+				t.Errorf("Content-Type = %q, want %s", ct, problemContentType)
+			}
+			if w.Header().Get("X-Content-Type-Options") != "nosniff" {
+				t.Error("no X-Content-Type-Options: nosniff")
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode %s: %s", w.Body, err)
+			}
+			for _, key := range []string{"type", "title", "status", "instance", "code"} {
+				if _, ok := body[key]; !ok {
+					t.Errorf("problem has no %q: %s", key, w.Body)
+				}
+			}
+			if body["status"] != float64(tt.status) || body["title"] != http.StatusText(tt.status) || body["instance"] != "/me" {
+				t.Errorf("problem = %s", w.Body)
+			}
+			if detail, _ := body["detail"].(string); detail != tt.detail {
+				t.Errorf("detail = %q, want %q", detail, tt.detail)
+			}
+			if msg := tt.err.Error(); tt.status >= 500 && strings.Contains(w.Body.String(), msg) {
+				t.Errorf("internal error %q leaked in %s", msg, w.Body)
+			}
+		})
+	}
+}
+
+func TestHandleErrorAfterWrite(t *testing.T) {
+	a, log := newTestApp(t)
+	rec := httptest.NewRecorder()
+	w := NewResponseWriter(rec)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("partial"))
+	a.handleError(w, httptest.NewRequest("GET", "/", nil), errors.New("late failure"))
+	if rec.Body.String() != "partial" {
+		t.Errorf("body = %q, want the partial response only", rec.Body)
+	}
+	if !strings.Contains(log.String(), "response already written") {
+		t.Errorf("dropped error not logged:\n%s", log)
+	}
+}
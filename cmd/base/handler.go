@@ -1,7 +1,7 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
 	"net/http"
 )
 
@@ -23,31 +23,66 @@ func (a *App) Wrap(hn HandlerWithError) http.Handler {
 }
 
 // handleError is the catch-all error function.
-// It handles generic errors that may be returned by any http handler.
+// It handles generic errors that may be returned by any http handler and
+// renders them as RFC 7807 problem details, or as an HTML error page for
+// browsers. It writes exactly one response: if the handler already started
+// the response the error is only logged.
 func (a *App) handleError(w http.ResponseWriter, req *http.Request, err error) {
-	//u := getUser(req)
-	//lp := &localPresenter{PageTitle: "404 Page Not Found", PageURL: req.URL.String(), globalPresenter: a.gp, User: u}
-	switch e := err.(type) {
-	case *APIError:
-		a.logr.Log("HTTP %d - %s\n", e.Status(), e)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(e.Status())
-		err = json.NewEncoder(w).Encode(e)
-		if err != nil {
-			a.logr.Log("error when return json %s", e)
+	p := newProblem(req, err)
+	l := a.log(req)
+	if p.Status >= 500 {
+		kv := []interface{}{"status", p.Status, "err", err}
+		var pe *panicError
+		if errors.As(err, &pe) {
+			kv = append(kv, "stack", string(pe.stack))
 		}
-	case Error:
-		// We can retrieve the status here and write out a specific
-		// HTTP status code.
-		if e.Status() == 404 {
-			//a.rndr.HTML(w, e.Status(), "404", lp)
-		} else {
-			http.Error(w, http.StatusText(e.Status()), e.Status())
+		l.Error("request failed", kv...)
+		a.reportError(req, p.Status, err)
+	} else {
+		l.Info("request failed", "status", p.Status, "err", err)
+	}
+
+	if rw, ok := w.(ResponseWriter); ok && rw.Written() {
+		l.Warn("response already written, dropping error", "path", req.URL.Path)
+		return
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Add("Vary", "Accept")
+	if negotiate(req.Header.Get("Accept"), []string{problemContentType, mediaJSON, mediaHTML}) == mediaHTML {
+		lp := &localPresenter{PageTitle: p.Title, PageURL: req.URL.String(), globalPresenter: a.gp, User: getUser(req), Problem: p}
+		err := a.rndr.HTML(w, p.Status, errorTemplate(p.Status), lp)
+		if err == nil {
+			return
 		}
-		a.logr.Log("HTTP %d - %s\n", e.Status(), e)
-	default:
-		// Any error types we don't specifically look out for default to serving a terrible HTTP 500
-		a.logr.Log("HTTP %d - %s\n", 500, e)
-		//a.rndr.HTML(w, http.StatusInternalServerError, "500", lp)
+		l.Error("error when rendering error page", "err", err)
+	}
+	if err := a.rndr.jsonAs(w, p.Status, problemContentType, p, a.rndr.opts.PrettyJSON); err != nil {
+		l.Error("error when return json", "err", err)
+	}
+}
+
+// errorTemplate return the page template of an error status
+func errorTemplate(status int) string {
+	switch {
+	case status == http.StatusNotFound:
+		return "404"
+	case status >= 500:
+		return "500"
+	}
+	return "error"
+}
+
+// NotFoundHandler renders a problem for requests that match no route
+func (a *App) NotFoundHandler() HandlerWithError {
+	return func(w http.ResponseWriter, req *http.Request) error {
+		return newAPIError(http.StatusNotFound, "no route matches "+req.URL.Path, nil).WithCode("route_not_found")
+	}
+}
+
+// MethodNotAllowedHandler renders a problem for requests whose path matches
+// a route but not its method. The router sets the Allow header beforehand.
+func (a *App) MethodNotAllowedHandler() HandlerWithError {
+	return func(w http.ResponseWriter, req *http.Request) error {
+		return newAPIError(http.StatusMethodNotAllowed, req.Method+" is not allowed on "+req.URL.Path, nil)
 	}
 }
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"base"
+)
+
+// Health check defaults
+const (
+	defaultCheckTimeout = 2 * time.Second
+	defaultCheckTTL     = 5 * time.Second
+	defaultMinFreeDisk  = 100 << 20
+)
+
+// Health check kinds. Liveness checks fail when only a restart helps and
+// back /healthz. Readiness checks fail when the app cannot serve requests
+// for now and back /readyz along with the liveness checks.
+const (
+	checkLiveness  = "liveness"
+	checkReadiness = "readiness"
+)
+
+var (
+	// errCheckTimeout for a check that did not finish within its timeout
+	errCheckTimeout = errors.New("check timed out")
+	// errDiskFreeUnsupported when the platform cannot report free disk space
+	errDiskFreeUnsupported = errors.New("free disk space is not supported")
+)
+
+// HealthCheck return an error when the checked dependency is unhealthy.
+// It must return when ctx is done.
+type HealthCheck func(ctx context.Context) error
+
+// checkResult is the outcome of a check, as shown to clients
+type checkResult struct {
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Duration  float64   `json:"duration_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// healthStatus is the body of /healthz and /readyz
+type healthStatus struct {
+	Status string                  `json:"status"`
+	Checks map[string]*checkResult `json:"checks"`
+}
+
+// registeredCheck is a check with its cached result
+type registeredCheck struct {
+	name    string
+	kind    string
+	timeout time.Duration
+	fn      HealthCheck
+
+	mu     sync.Mutex
+	result *checkResult
+}
+
+// healthRegistry holds the named health checks of the app
+type healthRegistry struct {
+	ttl time.Duration
+
+	mu     sync.RWMutex
+	checks []*registeredCheck
+}
+
+func newHealthRegistry(ttl time.Duration) *healthRegistry {
+	return &healthRegistry{ttl: ttl}
+}
+
+// Register adds the check name of kind, checkLiveness or checkReadiness.
+// A zero timeout uses defaultCheckTimeout. Names are unique.
+func (h *healthRegistry) Register(name, kind string, timeout time.Duration, fn HealthCheck) {
+	if timeout <= 0 {
+		timeout = defaultCheckTimeout
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, c := range h.checks {
+		if c.name == name {
+			panic(fmt.Sprintf("health check %q registered twice", name))
+		}
+	}
+	h.checks = append(h.checks, &registeredCheck{name: name, kind: kind, timeout: timeout, fn: fn})
+}
+
+// Run runs the checks of kinds concurrently, reusing results younger than
+// the cache TTL, and return the overall status
+func (h *healthRegistry) Run(ctx context.Context, kinds ...string) *healthStatus {
+	h.mu.RLock()
+	var checks []*registeredCheck
+	for _, c := range h.checks {
+		if contains(kinds, c.kind) {
+			checks = append(checks, c)
+		}
+	}
+	h.mu.RUnlock()
+
+	results := make([]*checkResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *registeredCheck) {
+			defer wg.Done()
+			results[i] = c.run(ctx, h.ttl)
+		}(i, c)
+	}
+	wg.Wait()
+
+	st := &healthStatus{Status: "ok", Checks: map[string]*checkResult{}}
+	for i, c := range checks {
+		st.Checks[c.name] = results[i]
+		if results[i].Status != "ok" {
+			st.Status = "fail"
+		}
+	}
+	return st
+}
+
+// run return the cached result or runs the check within its timeout.
+// Concurrent callers wait for a single run. The result is shared by every
+// caller for the TTL, so the check ignores the cancellation of ctx and
+// only keeps its values: a client hanging up must not cache a timeout.
+func (c *registeredCheck) run(ctx context.Context, ttl time.Duration) *checkResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.result != nil && time.Since(c.result.CheckedAt) < ttl {
+		return c.result
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.timeout)
+	defer cancel()
+	t1 := base.TimeNow()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.fn(ctx)
+	}()
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		err = errCheckTimeout
+	}
+
+	r := &checkResult{Status: "ok", Duration: float64(time.Since(t1).Microseconds()) / 1000, CheckedAt: t1}
+	if err != nil {
+		r.Status = "fail"
+		r.Error = err.Error()
+	}
+	c.result = r
+	return r
+}
+
+// HealthzHandler reports whether the app is alive
+func (a *App) HealthzHandler() HandlerWithError {
+	return a.healthHandler(checkLiveness)
+}
+
+// ReadyzHandler reports whether the app is ready to serve requests
+func (a *App) ReadyzHandler() HandlerWithError {
+	return a.healthHandler(checkLiveness, checkReadiness)
+}
+
+// healthHandler renders the checks of kinds, with 503 when one fails
+func (a *App) healthHandler(kinds ...string) HandlerWithError {
+	return func(w http.ResponseWriter, req *http.Request) error {
+		st := a.health.Run(req.Context(), kinds...)
+		status := http.StatusOK
+		if st.Status != "ok" {
+			status = http.StatusServiceUnavailable
+			for name, r := range st.Checks {
+				if r.Status != "ok" {
+					a.log(req).Warn("health check failed", "check", name, "err", r.Error)
+				}
+			}
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		return a.rndr.JSON(w, status, st)
+	}
+}
+
+// registerHealthChecks registers the built-in checks
+func (a *App) registerHealthChecks() {
+	a.health.Register("workers", checkLiveness, 0, a.checkWorkers)
+	a.health.Register("db", checkReadiness, 0, a.checkDB)
+	a.health.Register("disk", checkReadiness, 0, a.checkDisk)
+	a.health.Register("config", checkReadiness, 0, a.checkConfig)
+}
+
+// checkWorkers fails when a background worker has stopped
+func (a *App) checkWorkers(ctx context.Context) error {
+	if a.sessions != nil && !a.sessions.Running() {
+		return errors.New("session sweeper is not running")
+	}
+	if a.snapshots != nil && !a.snapshots.Running() {
+		return errors.New("snapshot scheduler is not running")
+	}
+	return nil
+}
+
+// checkDB fails when a read transaction cannot be opened
+func (a *App) checkDB(ctx context.Context) error {
+	return a.db.View(func(tx *bolt.Tx) error {
+		return nil
+	})
+}
+
+// checkDisk fails when the disk holding the database is almost full
+func (a *App) checkDisk(ctx context.Context) error {
+	free, err := diskFree(filepath.Dir(a.db.Path()))
+	if err == errDiskFreeUnsupported {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if min := a.cfg().MinFreeDisk; free < uint64(min) {
+		return fmt.Errorf("%d bytes free, need %d", free, min)
+	}
+	return nil
+}
+
+// checkConfig fails when the running config is not valid
+func (a *App) checkConfig(ctx context.Context) error {
+	return a.cfg().validate()
+}
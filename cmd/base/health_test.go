@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthCancelledCallerDoesNotCacheFailure(t *testing.T) {
+	h := newHealthRegistry(time.Minute)
+	h.Register("slow", checkReadiness, time.Second, func(ctx context.Context) error {
+		select {
+		case <-time.After(20 * time.Millisecond):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if st := h.Run(ctx, checkReadiness); st.Status != "ok" {
+		t.Fatalf("run with a cancelled request = %+v", st.Checks["slow"])
+	}
+	if st := h.Run(context.Background(), checkReadiness); st.Status != "ok" {
+		t.Errorf("next run = %+v", st.Checks["slow"])
+	}
+}
+
+func TestHealthTimeoutAndCache(t *testing.T) {
+	h := newHealthRegistry(time.Minute)
+	var runs atomic.Int32
+	h.Register("stuck", checkLiveness, 10*time.Millisecond, func(ctx context.Context) error {
+		runs.Add(1)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	h.Register("broken", checkReadiness, 0, func(ctx context.Context) error {
+		return errors.New("down")
+	})
+
+	st := h.Run(context.Background(), checkLiveness)
+	if st.Status != "fail" || st.Checks["stuck"].Error != errCheckTimeout.Error() {
+		t.Fatalf("run = %+v", st.Checks["stuck"])
+	}
+	if _, ok := st.Checks["broken"]; ok {
+		t.Error("liveness run included a readiness check")
+	}
+	h.Run(context.Background(), checkLiveness)
+	if n := runs.Load(); n != 1 {
+		t.Errorf("check ran %d times within the TTL, want 1", n)
+	}
+
+	st = h.Run(context.Background(), checkLiveness, checkReadiness)
+	if st.Checks["broken"].Error != "down" {
+		t.Errorf("broken check = %+v", st.Checks["broken"])
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"net/http"
 
 	"base"
@@ -14,9 +13,9 @@ func (a *App) IndexHandler(db *base.DB) HandlerWithError {
 		}{
 			Status: "success",
 		}
-		err := json.NewEncoder(w).Encode(result)
+		err := a.rndr.JSON(w, http.StatusOK, result)
 		if err != nil {
-			return newAPIError(500, "error when encoding response, %s", err)
+			return newAPIError(500, "error when encoding response", err)
 		}
 
 		return nil
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/pflag"
+
+	"base"
+)
+
+const indexUsage = `usage: base index <command>
+
+commands:
+  verify    report index entries that drifted from their primary bucket
+  rebuild   recreate every index from its primary bucket
+`
+
+// indexers return the user store and every registered indexer
+func indexers(db *base.DB) []base.Indexer {
+	return append([]base.Indexer{db.Users()}, base.Indexers()...)
+}
+
+// runIndex runs the index command and return the process exit code
+func runIndex(pwd string, args []string) int {
+	fs := pflag.NewFlagSet("index", pflag.ContinueOnError)
+	commandFlags(fs, pwd)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, indexUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsageError
+	}
+	args = fs.Args()
+	if len(args) != 1 {
+		fs.Usage()
+		return exitUsageError
+	}
+
+	db, code := openCommandDB(pwd, fs, false)
+	if db == nil {
+		return code
+	}
+	defer closeDB(db)
+
+	switch args[0] {
+	case "verify":
+		code := exitOK
+		for _, ix := range indexers(db) {
+			problems, err := ix.VerifyIndexes()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error on verifying %s: %s\n", ix.Bucket(), err)
+				return exitCommandError
+			}
+			for _, p := range problems {
+				fmt.Println(p)
+				code = exitCommandError
+			}
+			if len(problems) == 0 {
+				fmt.Printf("%s: ok\n", ix.Bucket())
+			}
+		}
+		return code
+	case "rebuild":
+		for _, ix := range indexers(db) {
+			if err := ix.RebuildIndexes(); err != nil {
+				fmt.Fprintf(os.Stderr, "error on rebuilding %s: %s\n", ix.Bucket(), err)
+				return exitCommandError
+			}
+			fmt.Printf("%s: rebuilt\n", ix.Bucket())
+		}
+		return exitOK
+	default:
+		fs.Usage()
+		return exitUsageError
+	}
+}
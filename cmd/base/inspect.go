@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"unicode/utf8"
+
+	"github.com/boltdb/bolt"
+	"github.com/spf13/pflag"
+
+	"base"
+)
+
+const dbUsage = `usage: base db inspect [--limit N] [--prefix P] [BUCKET]
+
+Without BUCKET, list the buckets with their key counts. With BUCKET, dump
+its keys as JSON lines. The database is opened read-only, pass --db-path
+to inspect a snapshot while the server runs.
+`
+
+// inspectEntry is a dumped key and value. Keys of 8 bytes are shown as
+// IDs, JSON values as is, other bytes as text or hex.
+type inspectEntry struct {
+	Key    string          `json:"key"`
+	ID     *uint64         `json:"id,omitempty"`
+	Value  json.RawMessage `json:"value,omitempty"`
+	Text   string          `json:"text,omitempty"`
+	Hex    string          `json:"hex,omitempty"`
+	Bucket bool            `json:"bucket,omitempty"`
+}
+
+// runDB runs the db command and return the process exit code
+func runDB(pwd string, args []string) int {
+	fs := pflag.NewFlagSet("db", pflag.ContinueOnError)
+	limit := fs.Int("limit", 0, "dump at most N keys, 0 for all")
+	prefix := fs.String("prefix", "", "dump only keys starting with P")
+	commandFlags(fs, pwd)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, dbUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsageError
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 || fs.Arg(0) != "inspect" {
+		fs.Usage()
+		return exitUsageError
+	}
+
+	db, code := openCommandDB(pwd, fs, true)
+	if db == nil {
+		return code
+	}
+	defer closeDB(db)
+
+	var err error
+	if fs.NArg() == 1 {
+		err = listBuckets(db)
+	} else {
+		q := base.Query{Limit: *limit}
+		if *prefix != "" {
+			q.Prefix = []byte(*prefix)
+		}
+		err = dumpBucket(db, []byte(fs.Arg(1)), q)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error on inspecting db: %s\n", err)
+		return exitCommandError
+	}
+	return exitOK
+}
+
+// listBuckets prints the top level buckets with their key counts
+func listBuckets(db *base.DB) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "BUCKET\tKEYS")
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			fmt.Fprintf(w, "%s\t%d\n", name, b.Stats().KeyN)
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// dumpBucket prints the keys of bucket selected by q as JSON lines
+func dumpBucket(db *base.DB, bucket []byte, q base.Query) error {
+	found := false
+	err := db.View(func(tx *bolt.Tx) error {
+		found = tx.Bucket(bucket) != nil
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("no bucket %q", bucket)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	_, err = db.Scan(bucket, q, func(k, v []byte) error {
+		return enc.Encode(newInspectEntry(k, v))
+	})
+	return err
+}
+
+func newInspectEntry(k, v []byte) inspectEntry {
+	e := inspectEntry{Key: displayBytes(k)}
+	if len(k) == 8 {
+		id := base.KeyUint64(k)
+		e.ID = &id
+	}
+	switch {
+	case v == nil:
+		e.Bucket = true
+	case json.Valid(v):
+		e.Value = json.RawMessage(v)
+	case utf8.Valid(v):
+		e.Text = string(v)
+	default:
+		e.Hex = hex.EncodeToString(v)
+	}
+	return e
+}
+
+// displayBytes return b as text when it is printable, as hex otherwise
+func displayBytes(b []byte) string {
+	if utf8.Valid(b) {
+		for _, r := range string(b) {
+			if r < 0x20 || r == 0x7f {
+				return hex.EncodeToString(b)
+			}
+		}
+		return string(b)
+	}
+	return hex.EncodeToString(b)
+}
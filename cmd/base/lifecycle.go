@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Exit codes returned by the process when the app lifecycle or a command fails.
+const (
+	exitOK = iota
+	exitStartError
+	exitServeError
+	exitShutdownError
+	exitUsageError
+	exitCommandError
+)
+
+// defaultShutdownTimeout is how long Stop waits for in-flight requests to drain
+const defaultShutdownTimeout = 15 * time.Second
+
+// Defaults of the server timeouts, bounding how long a client can hold a
+// connection
+const (
+	defaultReadHeaderTimeout = 5 * time.Second
+	defaultReadTimeout       = 30 * time.Second
+	defaultWriteTimeout      = 30 * time.Second
+	defaultIdleTimeout       = 2 * time.Minute
+	defaultBackupTimeout     = 10 * time.Minute
+)
+
+// StartHook is called before the server starts accepting connections.
+type StartHook func(a *App) error
+
+// ShutdownHook is called after the server has stopped accepting connections.
+// The context carries the shutdown deadline.
+type ShutdownHook func(ctx context.Context) error
+
+// logFlusher is implemented by loggers that buffer their output
+type logFlusher interface {
+	Flush() error
+}
+
+// OnStart registers a hook run by Start, in registration order.
+func (a *App) OnStart(fn StartHook) {
+	a.onStart = append(a.onStart, fn)
+}
+
+// OnShutdown registers a hook run by Stop, in reverse registration order.
+func (a *App) OnShutdown(fn ShutdownHook) {
+	a.onShutdown = append(a.onShutdown, fn)
+}
+
+// addr returns the listen address for the configured port
+func (c baseConfig) addr() string {
+	port := c.Port
+	if port == "" {
+		port = "3000"
+	}
+	if strings.Contains(port, ":") {
+		return port
+	}
+	return ":" + port
+}
+
+// Start runs the start hooks and serves HTTP until the server fails or
+// the process receives SIGINT or SIGTERM, then stops the app gracefully.
+// It returns the process exit code.
+func (a *App) Start() int {
+	for _, fn := range a.onStart {
+		if err := fn(a); err != nil {
+			a.logr.Error("error on start hook", "err", err)
+			a.Stop()
+			return exitStartError
+		}
+	}
+
+	cfg := a.cfg()
+	a.server = &http.Server{
+		Addr:              cfg.addr(),
+		Handler:           a.router,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		a.logr.Info("listening", "addr", a.server.Addr)
+		serveErr <- a.server.ListenAndServe()
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	code := exitOK
+	select {
+	case err := <-serveErr:
+		if err != nil && err != http.ErrServerClosed {
+			a.logr.Error("error on serve server", "err", err)
+			code = exitServeError
+		}
+	case sig := <-quit:
+		a.logr.Info("shutting down", "signal", sig.String())
+	}
+
+	if err := a.Stop(); err != nil && code == exitOK {
+		code = exitShutdownError
+	}
+	return code
+}
+
+// Stop drains in-flight requests within the configured deadline, runs the
+// shutdown hooks, closes the database and flushes the logger.
+func (a *App) Stop() error {
+	timeout := a.cfg().ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var firstErr error
+	keep := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if a.server != nil {
+		if err := a.server.Shutdown(ctx); err != nil {
+			a.logr.Error("error on shutting down server", "err", err)
+			keep(err)
+		}
+	}
+
+	for i := len(a.onShutdown) - 1; i >= 0; i-- {
+		if err := a.onShutdown[i](ctx); err != nil {
+			a.logr.Error("error on shutdown hook", "err", err)
+			keep(err)
+		}
+	}
+
+	if a.db != nil {
+		if err := a.db.Close(); err != nil {
+			a.logr.Error("error on closing db", "err", err)
+			keep(err)
+		}
+	}
+
+	if f, ok := a.logr.(logFlusher); ok {
+		keep(f.Flush())
+	}
+	return firstErr
+}
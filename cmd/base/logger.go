@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// appLogger is an interface for leveled, structured logging. Every method
+// takes a message followed by key-value pairs, e.g.
+// Info("user created", "user_id", 42).
+// Used to introduce a seam into the app, for testing
+type appLogger interface {
+	Debug(msg string, kv ...interface{})
+	Info(msg string, kv ...interface{})
+	Warn(msg string, kv ...interface{})
+	Error(msg string, kv ...interface{})
+	// With return a child logger adding kv to every entry
+	With(kv ...interface{}) appLogger
+}
+
+// Log output formats
+const (
+	logFormatLogfmt = "logfmt"
+	logFormatJSON   = "json"
+)
+
+// baseLogger writes entries in logfmt or JSON through log/slog
+type baseLogger struct {
+	logger *slog.Logger
+	level  *slog.LevelVar
+	out    io.Writer
+}
+
+// newLogger return a logger writing entries at level or above to out in
+// format, logfmt or json
+func newLogger(out io.Writer, format, level string) (*baseLogger, error) {
+	lv := new(slog.LevelVar)
+	if err := lv.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: lv, ReplaceAttr: logTime}
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case logFormatLogfmt, "":
+		h = slog.NewTextHandler(out, opts)
+	case logFormatJSON:
+		h = slog.NewJSONHandler(out, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q", format)
+	}
+	return &baseLogger{logger: slog.New(h), level: lv, out: out}, nil
+}
+
+// logTime writes entry times in UTC with second precision
+func logTime(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.TimeKey && len(groups) == 0 {
+		a.Value = slog.StringValue(a.Value.Time().UTC().Format(time.RFC3339))
+	}
+	return a
+}
+
+// Debug logs at debug level
+func (ml *baseLogger) Debug(msg string, kv ...interface{}) { ml.logger.Debug(msg, kv...) }
+
+// Info logs at info level
+func (ml *baseLogger) Info(msg string, kv ...interface{}) { ml.logger.Info(msg, kv...) }
+
+// Warn logs at warn level
+func (ml *baseLogger) Warn(msg string, kv ...interface{}) { ml.logger.Warn(msg, kv...) }
+
+// Error logs at error level
+func (ml *baseLogger) Error(msg string, kv ...interface{}) { ml.logger.Error(msg, kv...) }
+
+// With return a child logger sharing the level and output
+func (ml *baseLogger) With(kv ...interface{}) appLogger {
+	return &baseLogger{logger: ml.logger.With(kv...), level: ml.level, out: ml.out}
+}
+
+// SetLevel changes the level of the logger and all its children
+func (ml *baseLogger) SetLevel(level string) error {
+	var lv slog.Level
+	if err := lv.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q", level)
+	}
+	ml.level.Set(lv)
+	return nil
+}
+
+// Flush writes any buffered log output to stable storage
+func (ml *baseLogger) Flush() error {
+	f, ok := ml.out.(*os.File)
+	if !ok {
+		return nil
+	}
+	// Sync fails on terminals and pipes, only regular files need it
+	if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+		return f.Sync()
+	}
+	return nil
+}
+
+// withLogger return ctx carrying the request logger l
+func withLogger(ctx context.Context, l appLogger) context.Context {
+	return context.WithValue(ctx, loggerKey, l)
+}
+
+// log return the logger of the request, carrying its request and user IDs,
+// or the app logger outside of a request
+func (a *App) log(req *http.Request) appLogger {
+	if req != nil {
+		if l, ok := req.Context().Value(loggerKey).(appLogger); ok {
+			return l
+		}
+	}
+	return a.logr
+}
@@ -5,46 +5,174 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"path"
-	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/boltdb/bolt"
-	"github.com/gorilla/context"
-	"github.com/justinas/alice"
 	"github.com/kardianos/osext"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 
 	"base"
 )
 
-type baseConfig struct {
-	Port string
-}
-
 // App in main app
 type App struct {
-	router *Router
-	logr   appLogger
-	config baseConfig
+	router      *Router
+	rndr        *Renderer
+	gp          *globalPresenter
+	logr        appLogger
+	access      *accessLogger
+	metrics     *httpMetrics
+	health      *healthRegistry
+	reports     *reportQueue
+	config      atomic.Pointer[baseConfig]
+	subsMu      sync.Mutex
+	subscribers []ConfigSubscriber
+	reloads     reloadStats
+	watch       configWatch
+	db          *base.DB
+	sessions    *base.SessionStore
+	snapshots   *base.SnapshotScheduler
+	server      *http.Server
+	onStart     []StartHook
+	onShutdown  []ShutdownHook
 }
 
 // SetupApp setup all condition for start project
-func SetupApp(r *Router, logger appLogger) *App {
-	var config baseConfig
-	if viper.GetBool("isDevelopment") {
-		config = baseConfig{
-			Port: viper.GetString("port"),
-		}
-	} else {
-		config = baseConfig{
-			Port: os.Getenv("PORT"),
+func SetupApp(r *Router, logger appLogger, db *base.DB, config baseConfig) (*App, error) {
+	sessions := base.NewSessionStore(db, []byte(config.CookieSecret), config.SessionExpiry, config.previousCookieSecrets()...)
+	sessions.Secure = !config.IsDevelopment
+
+	a := &App{
+		router:   r,
+		gp:       &globalPresenter{SiteName: config.SiteName},
+		logr:     logger,
+		db:       db,
+		sessions: sessions,
+		metrics:  newHTTPMetrics(),
+		health:   newHealthRegistry(defaultCheckTTL),
+		reports:  newReportQueue(newErrorReporter(config.ErrorReportFile, config.ErrorReportURL), errorReportQueueLen),
+	}
+
+	a.config.Store(&config)
+
+	var err error
+	a.access, err = newAccessLogger(os.Stdout, config.AccessLogFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	templates, err := templateFS(config.TemplateDir)
+	if err != nil {
+		return nil, err
+	}
+	a.rndr, err = NewRenderer(RenderOptions{
+		FS:         templates,
+		Layout:     config.TemplateLayout,
+		Funcs:      a.templateFuncs(),
+		Reload:     config.IsDevelopment,
+		PrettyJSON: config.PrettyJSON || config.IsDevelopment,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if config.BackupInterval > 0 && config.BackupDir != "" {
+		a.snapshots = base.NewSnapshotScheduler(db, config.BackupDir, config.BackupInterval, config.BackupRetain)
+	}
+	a.registerHealthChecks()
+	a.OnConfigChange(a.applyLogConfig)
+	a.OnStart((*App).watchConfig)
+	a.OnStart((*App).checkMigrations)
+	a.OnStart((*App).startSessionSweeper)
+	a.OnStart((*App).startSnapshots)
+	a.OnShutdown(a.stopSessionSweeper)
+	a.OnShutdown(a.stopSnapshots)
+	a.OnShutdown(a.waitReports)
+	return a, nil
+}
+
+const usage = `usage: base [command] [flags]
+
+commands:
+  serve             serve the app, the default command
+  migrate           apply or list schema migrations
+  index             rebuild or check the secondary indexes
+  backup            write a consistent snapshot of the db
+  restore           replace the db with a snapshot
+  user              create a user or reset its password
+  routes            print the routing table
+  config            check or print the config
+  db                inspect the buckets of the db
+  secrets           manage the secrets of the keyfile
+  help              print this help
+
+Run base <command> --help for the flags of a command.
+`
+
+// commandFlags adds the flags locating the config file and the database to
+// the flag set of an offline command
+func commandFlags(fs *pflag.FlagSet, pwd string) {
+	fs.String("config", "", "config file, $"+envPrefix+"_CONFIG")
+	fs.String("db-path", defaultConfig(pwd).DBPath, "path of the bolt database, $"+envPrefix+"_DB_PATH")
+}
+
+// commandConfig return the config of an offline command read with the
+// flags of fs. Only the settings locating the database are validated, so
+// that the commands do not need the secrets of the server.
+func commandConfig(pwd string, fs *pflag.FlagSet) (baseConfig, error) {
+	if err := readConfiguration(pwd, fs); err != nil {
+		return baseConfig{}, err
+	}
+	var c baseConfig
+	if err := viper.Unmarshal(&c); err != nil {
+		return baseConfig{}, fmt.Errorf("cannot decode config: %s", err)
+	}
+	if c.DBPath == "" {
+		return baseConfig{}, configError{"dbPath: is required"}
+	}
+	return c, nil
+}
+
+// openCommandDB opens the database of an offline command, see
+// commandConfig. On failure it return a nil db and the process exit code.
+func openCommandDB(pwd string, fs *pflag.FlagSet, readOnly bool) (*base.DB, int) {
+	config, err := commandConfig(pwd, fs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, exitUsageError
+	}
+	db, err := openDB(config.DBPath, readOnly)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to open bolt db: %s\n", err)
+		return nil, exitCommandError
+	}
+	return db, exitOK
+}
+
+// openDB opens the bolt database at path and creates the missing buckets,
+// unless it is opened read-only
+func openDB(path string, readOnly bool) (*base.DB, error) {
+	boltdb, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second, ReadOnly: readOnly})
+	if err != nil {
+		return nil, err
+	}
+	db := &base.DB{DB: boltdb}
+	if !readOnly {
+		if err := db.CreateAllBuckets(); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("unable to create all buckets: %s", err)
 		}
 	}
+	return db, nil
+}
 
-	return &App{
-		router: r,
-		logr:   logger,
-		config: config,
+// closeDB closes the database of an offline command
+func closeDB(db *base.DB) {
+	if err := db.Close(); err != nil {
+		log.Printf("error on closing db %s", err)
 	}
 }
 
@@ -54,56 +182,81 @@ func main() {
 		log.Fatalf("cannot retrieve present working directory: %s", err)
 	}
 
-	boltdb, err := bolt.Open(path.Join(pwd, "base.db"), 0600, nil)
-	if err != nil {
-		log.Fatalf("unable to open bolt db: %s", err)
-	}
-	db := &base.DB{boltdb}
-	err = db.CreateAllBuckets()
-	if err != nil {
-		log.Fatalf("unable to CreateAllBucketsreate all bucket: %s", err)
+	cmd, args := "", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
 	}
 
-	err = LoadConfiguration(pwd)
-	if err != nil && viper.GetBool("isProduction") {
-		panic(fmt.Errorf("fatal error config file: %s ", err))
+	// Commands without a db parse their own flags and config
+	switch cmd {
+	case "help":
+		fmt.Print(usage)
+		os.Exit(exitOK)
+	case "routes":
+		os.Exit(runRoutes(args))
+	case "config":
+		os.Exit(runConfig(pwd, args))
+	case "secrets":
+		os.Exit(runSecrets(pwd, args))
+	case "migrate":
+		os.Exit(runMigrate(pwd, args))
+	case "index":
+		os.Exit(runIndex(pwd, args))
+	case "backup":
+		os.Exit(runBackup(pwd, args))
+	case "restore":
+		os.Exit(runRestore(pwd, args))
+	case "user":
+		os.Exit(runUser(pwd, args))
+	case "db":
+		os.Exit(runDB(pwd, args))
+	case "", "serve":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		os.Exit(exitUsageError)
 	}
 
-	r := NewRouter()
-	logr := newLogger()
-	a := SetupApp(r, logr)
+	flags := pflag.NewFlagSet("base", pflag.ContinueOnError)
+	configFlags(flags, pwd)
+	printConfig := flags.Bool("print-config", false, "print the config with secrets redacted and exit")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		fmt.Fprintln(os.Stderr, "\nserve flags:")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == pflag.ErrHelp {
+			os.Exit(exitOK)
+		}
+		os.Exit(exitUsageError)
+	}
 
-	common := alice.New(context.ClearHandler, a.loggingHandler, a.recoverHandler)
+	config, err := LoadConfiguration(pwd, flags)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsageError)
+	}
+	if *printConfig {
+		config.Print(os.Stdout)
+		os.Exit(exitOK)
+	}
 
-	r.Post("/", common.Then(a.Wrap(a.IndexHandler(db))))
+	db, err := openDB(config.DBPath, false)
+	if err != nil {
+		log.Fatalf("unable to open bolt db: %s", err)
+	}
 
-	err = http.ListenAndServe(":3000", r)
+	r := NewRouter()
+	logr, err := newLogger(os.Stdout, config.LogFormat, config.LogLevel)
 	if err != nil {
-		log.Fatalf("error on serve server %s", err)
+		log.Fatalf("unable to setup logger: %s", err)
 	}
-	defer func() {
-		err = db.Close()
-		if err != nil {
-			log.Fatalf("error on closing db %s", err)
-		}
-	}()
-}
+	a, err := SetupApp(r, logr, db, config)
+	if err != nil {
+		log.Fatalf("unable to setup app: %s", err)
+	}
+
+	a.setupRoutes(r, db)
 
-// LoadConfiguration load file config in directory
-func LoadConfiguration(pwd string) error {
-	viper.SetConfigName("base-config")
-	viper.AddConfigPath(pwd)
-	devPath := pwd[:len(pwd)-3] + "/src/base/cmd/base/"
-	_, file, _, _ := runtime.Caller(1)
-	configPath := path.Dir(file)
-	viper.AddConfigPath(devPath)
-	viper.AddConfigPath(configPath)
-
-	// setup for config path of product deployment
-	if os.Getenv("isDevelopment") == "false" {
-		productionConfigPath := ""
-		viper.AddConfigPath(productionConfigPath)
-	}
-	viper.SetDefault("path", devPath)
-	return viper.ReadInConfig() // Find and read the config file
+	os.Exit(a.Start())
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"base"
+)
+
+// newTestApp return an app in development mode on a temporary database,
+// with every route registered and its log written to the returned buffer
+func newTestApp(t *testing.T) (*App, *bytes.Buffer) {
+	t.Helper()
+	dir := t.TempDir()
+	boltdb, err := bolt.Open(filepath.Join(dir, "base.db"), 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := &base.DB{DB: boltdb}
+	t.Cleanup(func() { db.Close() })
+	if err := db.CreateAllBuckets(); err != nil {
+		t.Fatal(err)
+	}
+
+	config := defaultConfig(dir)
+	config.IsDevelopment = true
+	config.CookieSecret = developmentCookieSecret
+	config.AccessLogFormat = accessLogOff
+	var log bytes.Buffer
+	logr, err := newLogger(&log, logFormatLogfmt, "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRouter()
+	a, err := SetupApp(r, logr, db, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.setupRoutes(r, db)
+	return a, &log
+}
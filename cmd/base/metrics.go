@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"base"
+)
+
+// metricsContentType is the Prometheus text exposition format
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// unmatchedRoute labels requests that match no route, so unknown paths do
+// not create new series
+const unmatchedRoute = "unmatched"
+
+// otherMethod labels requests with a non-standard method, so clients
+// cannot create series with made-up methods
+const otherMethod = "other"
+
+// Histogram buckets of request durations, in seconds, and response sizes,
+// in bytes
+var (
+	durationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	sizeBuckets     = []float64{100, 1000, 10000, 100000, 1e6, 1e7}
+)
+
+// histogram counts observations in cumulative buckets
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// requestLabels identify a series of HTTP metrics
+type requestLabels struct {
+	route, method, status string
+}
+
+// requestSeries aggregates the requests of one label set
+type requestSeries struct {
+	count    uint64
+	duration *histogram
+	size     *histogram
+}
+
+// httpMetrics aggregates the requests served by the app
+type httpMetrics struct {
+	mu     sync.Mutex
+	series map[requestLabels]*requestSeries
+}
+
+func newHTTPMetrics() *httpMetrics {
+	return &httpMetrics{series: map[requestLabels]*requestSeries{}}
+}
+
+// observe records a request of route, method and status
+func (m *httpMetrics) observe(route, method string, status, size int, d time.Duration) {
+	l := requestLabels{route: route, method: method, status: strconv.Itoa(status)}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.series[l]
+	if !ok {
+		s = &requestSeries{duration: newHistogram(durationBuckets), size: newHistogram(sizeBuckets)}
+		m.series[l] = s
+	}
+	s.count++
+	s.duration.observe(d.Seconds())
+	s.size.observe(float64(size))
+}
+
+// metricsHandler middleware records the count, latency and response size
+// of every request, labelled by route pattern, method and status
+func (a *App) metricsHandler(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, req *http.Request) {
+		t1 := base.TimeNow()
+		next.ServeHTTP(w, req)
+
+		rw := w.(ResponseWriter)
+		status := rw.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		route := routePattern(req)
+		if route == "" {
+			route = unmatchedRoute
+		}
+		a.metrics.observe(route, methodLabel(req.Method), status, rw.Size(), time.Since(t1))
+	}
+	return http.HandlerFunc(fn)
+}
+
+// methodLabel return the method label of a request method
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return otherMethod
+}
+
+// MetricsHandler exposes the HTTP, bolt and Go runtime metrics in the
+// Prometheus text format
+func (a *App) MetricsHandler(db *base.DB) HandlerWithError {
+	return func(w http.ResponseWriter, req *http.Request) error {
+		var mw metricsWriter
+		a.metrics.write(&mw)
+		a.writeReloadMetrics(&mw)
+		a.writeReportMetrics(&mw)
+		writeBoltMetrics(&mw, db)
+		writeRuntimeMetrics(&mw)
+		return a.rndr.Data(w, http.StatusOK, metricsContentType, mw.buf.Bytes())
+	}
+}
+
+// write writes the HTTP metrics in a stable order
+func (m *httpMetrics) write(mw *metricsWriter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]requestLabels, 0, len(m.series))
+	for l := range m.series {
+		keys = append(keys, l)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+	labels := func(l requestLabels) []string {
+		return []string{"route", l.route, "method", l.method, "status", l.status}
+	}
+
+	mw.header("http_requests_total", "counter", "Total number of HTTP requests.")
+	for _, l := range keys {
+		mw.sample("http_requests_total", labels(l), float64(m.series[l].count))
+	}
+	mw.header("http_request_duration_seconds", "histogram", "Latency of HTTP requests.")
+	for _, l := range keys {
+		mw.histogram("http_request_duration_seconds", labels(l), m.series[l].duration)
+	}
+	mw.header("http_response_size_bytes", "histogram", "Size of HTTP response bodies.")
+	for _, l := range keys {
+		mw.histogram("http_response_size_bytes", labels(l), m.series[l].size)
+	}
+}
+
+// writeBoltMetrics writes the bolt database statistics
+func writeBoltMetrics(mw *metricsWriter, db *base.DB) {
+	st := db.Stats()
+	gauge := func(name, help string, v int) {
+		mw.header(name, "gauge", help)
+		mw.sample(name, nil, float64(v))
+	}
+	counter := func(name, help string, v float64) {
+		mw.header(name, "counter", help)
+		mw.sample(name, nil, v)
+	}
+	counter("bolt_read_tx_total", "Total number of started read transactions.", float64(st.TxN))
+	gauge("bolt_read_tx_open", "Number of open read transactions.", st.OpenTxN)
+	gauge("bolt_freelist_free_pages", "Number of free pages on the freelist.", st.FreePageN)
+	gauge("bolt_freelist_pending_pages", "Number of pending pages on the freelist.", st.PendingPageN)
+	gauge("bolt_freelist_free_bytes", "Bytes allocated in free pages.", st.FreeAlloc)
+	gauge("bolt_freelist_inuse_bytes", "Bytes used by the freelist.", st.FreelistInuse)
+	counter("bolt_tx_page_allocations_total", "Total number of page allocations.", float64(st.TxStats.PageCount))
+	counter("bolt_tx_page_allocated_bytes_total", "Total bytes allocated in pages.", float64(st.TxStats.PageAlloc))
+	counter("bolt_tx_cursors_total", "Total number of cursors created.", float64(st.TxStats.CursorCount))
+	counter("bolt_tx_node_allocations_total", "Total number of node allocations.", float64(st.TxStats.NodeCount))
+	counter("bolt_tx_rebalances_total", "Total number of node rebalances.", float64(st.TxStats.Rebalance))
+	counter("bolt_tx_splits_total", "Total number of node splits.", float64(st.TxStats.Split))
+	counter("bolt_tx_spills_total", "Total number of node spills.", float64(st.TxStats.Spill))
+	counter("bolt_tx_writes_total", "Total number of writes to disk.", float64(st.TxStats.Write))
+	counter("bolt_tx_write_seconds_total", "Total time spent writing to disk.", st.TxStats.WriteTime.Seconds())
+}
+
+// writeRuntimeMetrics writes the Go runtime statistics
+func writeRuntimeMetrics(mw *metricsWriter) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	mw.header("go_info", "gauge", "Information about the Go environment.")
+	mw.sample("go_info", []string{"version", runtime.Version()}, 1)
+	mw.header("go_goroutines", "gauge", "Number of goroutines.")
+	mw.sample("go_goroutines", nil, float64(runtime.NumGoroutine()))
+	mw.header("go_memstats_alloc_bytes", "gauge", "Bytes of allocated heap objects.")
+	mw.sample("go_memstats_alloc_bytes", nil, float64(ms.Alloc))
+	mw.header("go_memstats_heap_inuse_bytes", "gauge", "Bytes in in-use heap spans.")
+	mw.sample("go_memstats_heap_inuse_bytes", nil, float64(ms.HeapInuse))
+	mw.header("go_memstats_sys_bytes", "gauge", "Bytes of memory obtained from the OS.")
+	mw.sample("go_memstats_sys_bytes", nil, float64(ms.Sys))
+	mw.header("go_memstats_mallocs_total", "counter", "Total number of heap objects allocated.")
+	mw.sample("go_memstats_mallocs_total", nil, float64(ms.Mallocs))
+	mw.header("go_gc_cycles_total", "counter", "Total number of completed GC cycles.")
+	mw.sample("go_gc_cycles_total", nil, float64(ms.NumGC))
+	mw.header("go_gc_pause_seconds_total", "counter", "Total time spent in GC stop-the-world pauses.")
+	mw.sample("go_gc_pause_seconds_total", nil, float64(ms.PauseTotalNs)/1e9)
+}
+
+// metricsWriter formats samples in the Prometheus text format
+type metricsWriter struct {
+	buf bytes.Buffer
+}
+
+// labelEscaper escapes label values
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (mw *metricsWriter) header(name, typ, help string) {
+	fmt.Fprintf(&mw.buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes a sample; labels are name/value pairs
+func (mw *metricsWriter) sample(name string, labels []string, v float64) {
+	mw.buf.WriteString(name)
+	if len(labels) > 0 {
+		mw.buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				mw.buf.WriteByte(',')
+			}
+			fmt.Fprintf(&mw.buf, `%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1]))
+		}
+		mw.buf.WriteByte('}')
+	}
+	mw.buf.WriteByte(' ')
+	mw.buf.WriteString(formatFloat(v))
+	mw.buf.WriteByte('\n')
+}
+
+func (mw *metricsWriter) histogram(name string, labels []string, h *histogram) {
+	for i, b := range h.buckets {
+		mw.sample(name+"_bucket", append(labels[:len(labels):len(labels)], "le", formatFloat(b)), float64(h.counts[i]))
+	}
+	mw.sample(name+"_bucket", append(labels[:len(labels):len(labels)], "le", "+Inf"), float64(h.count))
+	mw.sample(name+"_sum", labels, h.sum)
+	mw.sample(name+"_count", labels, float64(h.count))
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsMethodLabel(t *testing.T) {
+	a := &App{metrics: newHTTPMetrics()}
+	h := wrapResponse(a.metricsHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {})))
+	for _, method := range []string{"GET", "FOO1", "BAR2"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/x", nil))
+	}
+
+	var mw metricsWriter
+	a.metrics.write(&mw)
+	out := mw.buf.String()
+	for _, want := range []string{`method="GET"`, `method="other"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics have no %s series", want)
+		}
+	}
+	for _, unwanted := range []string{"FOO1", "BAR2"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("metrics have a %s series", unwanted)
+		}
+	}
+	if !strings.Contains(out, `http_requests_total{route="unmatched",method="other",status="200"} 2`) {
+		t.Errorf("non-standard methods are not counted together:\n%s", out)
+	}
+}
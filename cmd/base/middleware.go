@@ -1,63 +1,41 @@
 package main
 
 import (
-	"log"
 	"net/http"
-	"os"
+	"runtime/debug"
 	"time"
 
 	"base"
 )
 
-// appLogger is an interface for logging.
-// Used to introduce a seam into the app, for testing
-type appLogger interface {
-	Log(str string, v ...interface{})
-}
-
-// baseLogger is a wrapper for long.Logger
-type baseLogger struct {
-	*log.Logger
-}
-
-// Log produces a log entry with the current time prepended
-func (ml *baseLogger) Log(str string, v ...interface{}) {
-	// Prepend current time to the slice of arguments
-	v = append(v, 0)
-	copy(v[1:], v[0:])
-	v[0] = base.TimeNow().Format(time.RFC3339)
-	ml.Printf("[%s] "+str, v...)
-}
-
-// newMiddlewareLogger returns a new middlewareLogger.
-func newLogger() *baseLogger {
-	return &baseLogger{log.New(os.Stdout, "[base] ", 0)}
-}
-
-// loggerHanderGenerator prduces a loggingHandler middleware
-// loggingHandler middleware logs all request
+// loggingHandler middleware writes the access log line of every request.
+// It must run after requestID.
 func (a *App) loggingHandler(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, req *http.Request) {
 		t1 := base.TimeNow()
-		a.logr.Log("Started %s %s", req.Method, req.URL.Path)
+		a.log(req).Debug("started", "method", req.Method, "path", req.URL.Path)
 
 		next.ServeHTTP(w, req)
 
 		rw := w.(ResponseWriter)
-		a.logr.Log("Completed %v %s in %v", rw.Status(), http.StatusText(rw.Status()), time.Since(t1))
+		a.log(req).Debug("completed", "status", rw.Status(), "duration", time.Since(t1))
+		a.access.Log(req, rw, t1)
 	}
 	return http.HandlerFunc(fn)
 }
 
-// recoverHandlerGenerator products a recoverHandler middleware
-// recoverHander is an middleware that captures and recovers from panics
+// recoverHander is an middleware that captures and recovers from panics.
+// The panic is handled as a 500 error, which logs it once with its stack
+// and reports it. http.ErrAbortHandler is passed on to abort the response.
 func (a *App) recoverHandler(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				a.logr.Log("Panic: %+v", err)
-				//
-				http.Error(w, http.StatusText(500), 500)
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+				pe := &panicError{value: err, stack: debug.Stack()}
+				a.handleError(w, r, &StatusError{Code: http.StatusInternalServerError, Err: pe})
 			}
 		}()
 		next.ServeHTTP(w, r)
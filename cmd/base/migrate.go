@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/spf13/pflag"
+
+	"base"
+)
+
+const migrateUsage = `usage: base migrate [--dry-run] <command>
+
+commands:
+  status    list registered migrations and whether they are applied
+  up        apply every pending migration
+  to N      apply pending migrations up to version N
+`
+
+// runMigrate runs the migrate command and return the process exit code
+func runMigrate(pwd string, args []string) int {
+	fs := pflag.NewFlagSet("migrate", pflag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "run migrations and roll them back")
+	commandFlags(fs, pwd)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsageError
+	}
+	args = fs.Args()
+	if len(args) == 0 {
+		fs.Usage()
+		return exitUsageError
+	}
+
+	db, code := openCommandDB(pwd, fs, false)
+	if db == nil {
+		return code
+	}
+	defer closeDB(db)
+
+	switch args[0] {
+	case "status":
+		return migrateStatus(db)
+	case "up":
+		applied, err := db.MigrateUp(*dryRun)
+		return reportMigrations(applied, err, *dryRun)
+	case "to":
+		if len(args) != 2 {
+			fs.Usage()
+			return exitUsageError
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid version %q\n", args[1])
+			return exitUsageError
+		}
+		applied, err := db.MigrateTo(version, *dryRun)
+		return reportMigrations(applied, err, *dryRun)
+	default:
+		fs.Usage()
+		return exitUsageError
+	}
+}
+
+// migrateStatus prints the status of every registered migration
+func migrateStatus(db *base.DB) int {
+	statuses, err := db.MigrationStatus()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error on reading migration status: %s\n", err)
+		return exitCommandError
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, st := range statuses {
+		applied := "pending"
+		if st.Applied {
+			applied = st.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", st.Version, st.Name, applied)
+	}
+	w.Flush()
+	return exitOK
+}
+
+// reportMigrations prints the applied migrations and the error, if any
+func reportMigrations(applied []base.Migration, err error, dryRun bool) int {
+	verb := "applied"
+	if dryRun {
+		verb = "would apply"
+	}
+	for _, m := range applied {
+		fmt.Printf("%s %d %s\n", verb, m.Version, m.Name)
+	}
+	if len(applied) == 0 && err == nil {
+		fmt.Println("no pending migrations")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error on migrating: %s\n", err)
+		return exitCommandError
+	}
+	return exitOK
+}
+
+// checkMigrations warns at startup when migrations are pending
+func (a *App) checkMigrations() error {
+	statuses, err := a.db.MigrationStatus()
+	if err != nil {
+		return err
+	}
+	pending := 0
+	for _, st := range statuses {
+		if !st.Applied {
+			pending++
+		}
+	}
+	if pending > 0 {
+		a.logr.Warn("pending migrations, run `base migrate up`", "pending", pending)
+	}
+	return nil
+}
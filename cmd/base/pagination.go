@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+
+	"base"
+)
+
+const (
+	// defaultPageLimit is the page size when the limit parameter is absent
+	defaultPageLimit = 20
+	// maxPageLimit caps the limit parameter
+	maxPageLimit = 100
+)
+
+// pageLinks holds the continuation cursors of a page and the URLs to fetch
+// the neighbouring pages
+type pageLinks struct {
+	Next     string `json:"next,omitempty"`
+	Prev     string `json:"prev,omitempty"`
+	NextLink string `json:"nextLink,omitempty"`
+	PrevLink string `json:"prevLink,omitempty"`
+}
+
+// pageEnvelope is the JSON body of list endpoints
+type pageEnvelope struct {
+	Data interface{} `json:"data"`
+	Page pageLinks   `json:"page"`
+}
+
+// pageQuery builds a query from the limit, cursor and order parameters
+func pageQuery(req *http.Request) (base.Query, error) {
+	q := base.Query{Cursor: QueryString(req, "cursor", "")}
+	limit, err := QueryInt(req, "limit", defaultPageLimit)
+	if err != nil {
+		return q, err
+	}
+	if limit <= 0 {
+		return q, newParamError("limit", "must be a positive integer")
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	q.Limit = limit
+	switch QueryString(req, "order", "asc") {
+	case "asc":
+	case "desc":
+		q.Reverse = true
+	default:
+		return q, newParamError("order", "must be asc or desc")
+	}
+	return q, nil
+}
+
+// pageError converts an error from a paged query into a handler error
+func pageError(err error) error {
+	if err == base.ErrInvalidCursor {
+		return newAPIError(400, "invalid cursor", nil).WithCode("invalid_cursor")
+	}
+	return newError(500, "error when querying page", err)
+}
+
+// writePage writes data in a page envelope with links to the next and
+// previous pages of the request
+func (a *App) writePage(w http.ResponseWriter, req *http.Request, data interface{}, page *base.PageInfo) error {
+	links := pageLinks{Next: page.Next, Prev: page.Prev}
+	if page.Next != "" {
+		links.NextLink = cursorURL(req, page.Next)
+	}
+	if page.Prev != "" {
+		links.PrevLink = cursorURL(req, page.Prev)
+	}
+	return a.rndr.JSON(w, http.StatusOK, pageEnvelope{Data: data, Page: links})
+}
+
+// cursorURL return the request URL with its cursor parameter replaced
+func cursorURL(req *http.Request, cursor string) string {
+	u := *req.URL
+	v := u.Query()
+	v.Set("cursor", cursor)
+	u.RawQuery = v.Encode()
+	return u.RequestURI()
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// contextKey is the type of the request context keys set by this package
+type contextKey string
+
+// Request context keys
+const (
+	paramsKey    contextKey = "params"
+	userKey      contextKey = "user"
+	sessionKey   contextKey = "session"
+	loggerKey    contextKey = "logger"
+	requestIDKey contextKey = "requestID"
+	routeKey     contextKey = "route"
+)
+
+// params return the route parameters of the request
+func params(req *http.Request) httprouter.Params {
+	ps, _ := req.Context().Value(paramsKey).(httprouter.Params)
+	return ps
+}
+
+// newParamError create a 400 API error for a malformed parameter
+func newParamError(name, msg string) *APIError {
+	e := newAPIError(http.StatusBadRequest, fmt.Sprintf("invalid parameter %q: %s", name, msg), nil)
+	e.Fields = []FieldError{{Field: name, Code: "invalid", Message: msg}}
+	return e.WithCode("invalid_parameter")
+}
+
+// ParamString return the path parameter name, which must not be empty
+func ParamString(req *http.Request, name string) (string, error) {
+	v := params(req).ByName(name)
+	if v == "" {
+		return "", newParamError(name, "is required")
+	}
+	return v, nil
+}
+
+// ParamInt return the path parameter name as an integer
+func ParamInt(req *http.Request, name string) (int64, error) {
+	v, err := ParamString(req, name)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, newParamError(name, "must be an integer")
+	}
+	return n, nil
+}
+
+// ParamID return the path parameter name as a positive record ID
+func ParamID(req *http.Request, name string) (uint64, error) {
+	v, err := ParamString(req, name)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil || n == 0 {
+		return 0, newParamError(name, "must be a positive integer")
+	}
+	return n, nil
+}
+
+// ParamUUID return the path parameter name as a lower-case canonical UUID
+func ParamUUID(req *http.Request, name string) (string, error) {
+	v, err := ParamString(req, name)
+	if err != nil {
+		return "", err
+	}
+	if !isUUID(v) {
+		return "", newParamError(name, "must be a UUID")
+	}
+	return strings.ToLower(v), nil
+}
+
+// QueryString return the query parameter name or def when it is absent
+func QueryString(req *http.Request, name, def string) string {
+	if v := req.URL.Query().Get(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// QueryInt return the query parameter name as an integer or def when it
+// is absent
+func QueryInt(req *http.Request, name string, def int) (int, error) {
+	v := req.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, newParamError(name, "must be an integer")
+	}
+	return n, nil
+}
+
+// QueryBool return the query parameter name as a boolean or def when it
+// is absent
+func QueryBool(req *http.Request, name string, def bool) (bool, error) {
+	v := req.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, newParamError(name, "must be true or false")
+	}
+	return b, nil
+}
+
+// isUUID reports whether s is a UUID in 8-4-4-4-12 hex form
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// paramRequest return a request carrying the path parameter id=v
+func paramRequest(v string) *http.Request {
+	req := httptest.NewRequest("GET", "/", nil)
+	ps := httprouter.Params{{Key: "id", Value: v}}
+	return req.WithContext(context.WithValue(req.Context(), paramsKey, ps))
+}
+
+// checkParamError fails unless err is a 400 invalid_parameter error on name
+func checkParamError(t *testing.T, err error, name string) {
+	t.Helper()
+	var ae *APIError
+	if !errors.As(err, &ae) {
+		t.Errorf("error = %v, want an API error", err)
+		return
+	}
+	if ae.Code != http.StatusBadRequest || ae.ErrCode != "invalid_parameter" || len(ae.Fields) != 1 || ae.Fields[0].Field != name {
+		t.Errorf("error = %+v, want a 400 invalid_parameter on %s", ae, name)
+	}
+}
+
+func TestParams(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		get   func(req *http.Request) (interface{}, error)
+		want  interface{}
+	}{
+		{"string", "abc", func(r *http.Request) (interface{}, error) { return ParamString(r, "id") }, "abc"},
+		{"string missing", "", func(r *http.Request) (interface{}, error) { return ParamString(r, "id") }, nil},
+		{"int", "-42", func(r *http.Request) (interface{}, error) { return ParamInt(r, "id") }, int64(-42)},
+		{"int missing", "", func(r *http.Request) (interface{}, error) { return ParamInt(r, "id") }, nil},
+		{"int malformed", "4x", func(r *http.Request) (interface{}, error) { return ParamInt(r, "id") }, nil},
+		{"int overflow", "9223372036854775808", func(r *http.Request) (interface{}, error) { return ParamInt(r, "id") }, nil},
+		{"id", "18446744073709551615", func(r *http.Request) (interface{}, error) { return ParamID(r, "id") }, uint64(18446744073709551615)},
+		{"id zero", "0", func(r *http.Request) (interface{}, error) { return ParamID(r, "id") }, nil},
+		{"id negative", "-1", func(r *http.Request) (interface{}, error) { return ParamID(r, "id") }, nil},
+		{"id overflow", "18446744073709551616", func(r *http.Request) (interface{}, error) { return ParamID(r, "id") }, nil},
+		{"id malformed", "1.5", func(r *http.Request) (interface{}, error) { return ParamID(r, "id") }, nil},
+		{"uuid", "0F8FAD5B-D9CB-469F-A165-70867728950E", func(r *http.Request) (interface{}, error) { return ParamUUID(r, "id") }, "0f8fad5b-d9cb-469f-a165-70867728950e"},
+		{"uuid malformed", "0f8fad5b-d9cb-469f-a165-70867728950", func(r *http.Request) (interface{}, error) { return ParamUUID(r, "id") }, nil},
+		{"uuid bad hex", "0f8fad5b-d9cb-469f-a165-70867728950g", func(r *http.Request) (interface{}, error) { return ParamUUID(r, "id") }, nil},
+		{"uuid dashes", "0f8fad5b0d9cb-469f-a165-70867728950e", func(r *http.Request) (interface{}, error) { return ParamUUID(r, "id") }, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.get(paramRequest(tt.value))
+			if tt.want == nil {
+				checkParamError(t, err, "id")
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("param %q = %v, %v, want %v", tt.value, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryParams(t *testing.T) {
+	req := httptest.NewRequest("GET", "/?s=x&n=7&big=9223372036854775808&bad=x&b=true&nb=yes", nil)
+	if got := QueryString(req, "s", "d"); got != "x" {
+		t.Errorf("QueryString = %q", got)
+	}
+	if got := QueryString(req, "missing", "d"); got != "d" {
+		t.Errorf("QueryString default = %q", got)
+	}
+	if n, err := QueryInt(req, "n", 1); n != 7 || err != nil {
+		t.Errorf("QueryInt = %d, %v", n, err)
+	}
+	if n, err := QueryInt(req, "missing", 1); n != 1 || err != nil {
+		t.Errorf("QueryInt default = %d, %v", n, err)
+	}
+	for _, name := range []string{"bad", "big"} {
+		_, err := QueryInt(req, name, 1)
+		checkParamError(t, err, name)
+	}
+	if b, err := QueryBool(req, "b", false); !b || err != nil {
+		t.Errorf("QueryBool = %v, %v", b, err)
+	}
+	if b, err := QueryBool(req, "missing", true); !b || err != nil {
+		t.Errorf("QueryBool default = %v, %v", b, err)
+	}
+	_, err := QueryBool(req, "nb", false)
+	checkParamError(t, err, "nb")
+}
+
+func TestParamErrorResponse(t *testing.T) {
+	a, _ := newTestApp(t)
+	r := NewRouter()
+	r.Get("/items/:id", a.Wrap(func(w http.ResponseWriter, req *http.Request) error {
+		id, err := ParamID(req, "id")
+		if err != nil {
+			return err
+		}
+		return a.rndr.Text(w, http.StatusOK, fmt.Sprint(id))
+	}))
+
+	for path, status := range map[string]int{
+		"/items/12":                   http.StatusOK,
+		"/items/abc":                  http.StatusBadRequest,
+		"/items/18446744073709551616": http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", mediaJSON)
+		r.ServeHTTP(w, req)
+		if w.Code != status {
+			t.Errorf("%s = %d %s, want %d", path, w.Code, w.Body, status)
+			continue
+		}
+		if status == http.StatusOK {
+			continue
+		}
+		var p Problem
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+			t.Fatalf("decode %s: %s", w.Body, err)
+		}
+		if p.Code != "invalid_parameter" || len(p.Errors) != 1 || p.Errors[0].Field != "id" {
+			t.Errorf("%s problem = %+v", path, p)
+		}
+	}
+}
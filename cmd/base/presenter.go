@@ -0,0 +1,19 @@
+package main
+
+import (
+	"base"
+)
+
+// globalPresenter holds the data shared by every page
+type globalPresenter struct {
+	SiteName string
+}
+
+// localPresenter holds the data of a single page
+type localPresenter struct {
+	*globalPresenter
+	PageTitle string
+	PageURL   string
+	User      *base.User
+	Problem   *Problem
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+
+	"base"
+)
+
+// ConfigSubscriber is called after a config reload swapped old for new
+type ConfigSubscriber func(old, new *baseConfig)
+
+// levelSetter is implemented by loggers whose level can change at runtime
+type levelSetter interface {
+	SetLevel(level string) error
+}
+
+// reloadStats counts the config reloads, for the metrics
+type reloadStats struct {
+	applied     atomic.Uint64
+	rejected    atomic.Uint64
+	lastApplied atomic.Int64
+}
+
+// configDebounce is how long the config file must stay quiet before it is
+// reloaded, so that the several events of one save make a single reload
+const configDebounce = 100 * time.Millisecond
+
+// configWatch debounces the change events of the config file and remembers
+// the content last seen, so that an unchanged file is not reloaded again
+type configWatch struct {
+	mu    sync.Mutex
+	timer *time.Timer
+	sum   [sha256.Size]byte
+}
+
+// cfg return the current config. It is replaced, never modified, on reload.
+func (a *App) cfg() *baseConfig {
+	return a.config.Load()
+}
+
+// OnConfigChange registers a subscriber called after every applied reload
+func (a *App) OnConfigChange(fn ConfigSubscriber) {
+	a.subsMu.Lock()
+	defer a.subsMu.Unlock()
+	a.subscribers = append(a.subscribers, fn)
+}
+
+// watchConfig reloads the config when the config file changes
+func (a *App) watchConfig() error {
+	file := viper.ConfigFileUsed()
+	if file == "" {
+		return nil
+	}
+	if data, err := os.ReadFile(file); err == nil {
+		a.watch.sum = sha256.Sum256(data)
+	}
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		a.watch.mu.Lock()
+		defer a.watch.mu.Unlock()
+		if a.watch.timer != nil {
+			a.watch.timer.Stop()
+		}
+		a.watch.timer = time.AfterFunc(configDebounce, a.reloadConfigFile)
+	})
+	viper.WatchConfig()
+	a.logr.Info("watching config file", "file", file)
+	return nil
+}
+
+// reloadConfigFile reads and parses the config file again, then reloads the
+// config unless the content did not change since the last reload. A file
+// that cannot be read or parsed rejects the reload.
+func (a *App) reloadConfigFile() {
+	a.watch.mu.Lock()
+	defer a.watch.mu.Unlock()
+	file := viper.ConfigFileUsed()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		a.reloads.rejected.Add(1)
+		a.logr.Error("config reload rejected", "err", err)
+		return
+	}
+	sum := sha256.Sum256(data)
+	if sum == a.watch.sum {
+		return
+	}
+	a.watch.sum = sum
+	// parse on the side first: viper drops its settings on a failed read
+	check := viper.New()
+	check.SetConfigType(strings.TrimPrefix(filepath.Ext(file), "."))
+	if err := check.ReadConfig(bytes.NewReader(data)); err != nil {
+		a.reloads.rejected.Add(1)
+		a.logr.Error("config reload rejected", "file", file, "err", err)
+		return
+	}
+	if err := viper.ReadConfig(bytes.NewReader(data)); err != nil {
+		a.reloads.rejected.Add(1)
+		a.logr.Error("config reload rejected", "file", file, "err", err)
+		return
+	}
+	a.reloadConfig()
+}
+
+// reloadConfig applies the settings that can change at runtime from the
+// current viper settings. The new config is validated before it replaces
+// the current one; settings requiring a restart keep their running value
+// and are reported.
+func (a *App) reloadConfig() {
+	next, err := decodeConfig()
+	if err != nil {
+		a.reloads.rejected.Add(1)
+		a.logr.Error("config reload rejected", "err", err)
+		return
+	}
+
+	old := a.cfg()
+	merged := *old
+	var applied, restart []string
+	ov, nv, mv := reflect.ValueOf(*old), reflect.ValueOf(next), reflect.ValueOf(&merged).Elem()
+	for _, f := range configFields() {
+		if reflect.DeepEqual(ov.Field(f.index).Interface(), nv.Field(f.index).Interface()) {
+			continue
+		}
+		if f.reload {
+			mv.Field(f.index).Set(nv.Field(f.index))
+			applied = append(applied, f.key)
+		} else {
+			restart = append(restart, f.key)
+		}
+	}
+	if len(restart) > 0 {
+		a.logr.Warn("config changes require a restart", "keys", restart)
+	}
+	if len(applied) == 0 {
+		return
+	}
+
+	a.config.Store(&merged)
+	a.subsMu.Lock()
+	subs := append([]ConfigSubscriber(nil), a.subscribers...)
+	a.subsMu.Unlock()
+	for _, fn := range subs {
+		fn(old, &merged)
+	}
+	a.reloads.applied.Add(1)
+	a.reloads.lastApplied.Store(base.TimeNow().Unix())
+	a.logr.Info("config reloaded", "keys", applied)
+}
+
+// applyLogConfig is the subscriber applying log settings
+func (a *App) applyLogConfig(old, new *baseConfig) {
+	if old.LogLevel != new.LogLevel {
+		if l, ok := a.logr.(levelSetter); ok {
+			if err := l.SetLevel(new.LogLevel); err != nil {
+				a.logr.Error("error on setting log level", "err", err)
+			}
+		}
+	}
+	if old.AccessLogFormat != new.AccessLogFormat {
+		if err := a.access.SetFormat(new.AccessLogFormat); err != nil {
+			a.logr.Error("error on setting access log format", "err", err)
+		}
+	}
+}
+
+// writeReloadMetrics writes the config reload counters
+func (a *App) writeReloadMetrics(mw *metricsWriter) {
+	mw.header("config_reloads_total", "counter", "Total number of config reloads by result.")
+	mw.sample("config_reloads_total", []string{"result", "applied"}, float64(a.reloads.applied.Load()))
+	mw.sample("config_reloads_total", []string{"result", "rejected"}, float64(a.reloads.rejected.Load()))
+	mw.header("config_last_reload_timestamp_seconds", "gauge", "Time of the last applied config reload.")
+	mw.sample("config_last_reload_timestamp_seconds", nil, float64(a.reloads.lastApplied.Load()))
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/sha256"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestReloadConfigFile(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "base-config.json")
+	write := func(s string) {
+		t.Helper()
+		if err := os.WriteFile(file, []byte(s), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"isDevelopment": true, "logLevel": "info"}`)
+	t.Setenv("BASE_CONFIG", file)
+	cfg, err := LoadConfiguration(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logr, err := newLogger(io.Discard, "", "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &App{logr: logr}
+	a.config.Store(&cfg)
+	data, _ := os.ReadFile(file)
+	a.watch.sum = sha256.Sum256(data)
+
+	steps := []struct {
+		name              string
+		content           string
+		applied, rejected uint64
+		level             string
+	}{
+		{"unchanged", `{"isDevelopment": true, "logLevel": "info"}`, 0, 0, "info"},
+		{"applied", `{"isDevelopment": true, "logLevel": "debug"}`, 1, 0, "debug"},
+		{"malformed", `{"isDevelopment": true, "logLevel": `, 1, 1, "debug"},
+		{"malformed again", `{"isDevelopment": true, "logLevel": `, 1, 1, "debug"},
+		{"invalid", `{"isDevelopment": true, "logLevel": "bogus"}`, 1, 2, "debug"},
+		{"fixed", `{"isDevelopment": true, "logLevel": "warn"}`, 2, 2, "warn"},
+	}
+	for _, s := range steps {
+		write(s.content)
+		a.reloadConfigFile()
+		if got := a.reloads.applied.Load(); got != s.applied {
+			t.Errorf("%s: applied = %d, want %d", s.name, got, s.applied)
+		}
+		if got := a.reloads.rejected.Load(); got != s.rejected {
+			t.Errorf("%s: rejected = %d, want %d", s.name, got, s.rejected)
+		}
+		if got := a.cfg().LogLevel; got != s.level {
+			t.Errorf("%s: logLevel = %q, want %q", s.name, got, s.level)
+		}
+	}
+	if got := viper.GetString("logLevel"); got != "warn" {
+		t.Errorf("viper logLevel = %q, want warn", got)
+	}
+}
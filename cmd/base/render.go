@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Media types offered by the renderer
+const (
+	mediaJSON  = "application/json"
+	mediaXML   = "application/xml"
+	mediaText  = "text/plain"
+	mediaHTML  = "text/html"
+	charsetUTF = "; charset=utf-8"
+)
+
+// RenderOptions configures a Renderer
+type RenderOptions struct {
+	// FS holds the templates. Pages are named by their path relative to
+	// the root without the extension, e.g. "users/show". Files under
+	// layouts/ are layouts and files under partials/ are partials, which
+	// are available to every page as {{template "partials/name" .}}.
+	FS fs.FS
+	// Layout is the name of the layout wrapping every page, or "" for none.
+	// A layout renders its page with {{template "content" .}}.
+	Layout string
+	// Extension of template files, ".html" by default
+	Extension string
+	// Funcs are added to every template
+	Funcs template.FuncMap
+	// Reload parses the templates again before every HTML render, so
+	// template changes show up without a restart. Meant for development.
+	Reload bool
+	// PrettyJSON indents JSON output
+	PrettyJSON bool
+}
+
+// Renderer writes responses in the formats the client accepts. Every method
+// encodes the body before writing anything, so an encode error is returned
+// with the response still untouched.
+type Renderer struct {
+	opts RenderOptions
+
+	mu        sync.RWMutex
+	templates map[string]*template.Template
+}
+
+// NewRenderer return a renderer and loads the templates of opts.FS.
+// Without FS, HTML fails for every page.
+func NewRenderer(opts RenderOptions) (*Renderer, error) {
+	if opts.Extension == "" {
+		opts.Extension = ".html"
+	}
+	r := &Renderer{opts: opts}
+	if err := r.Load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Load parses the templates again
+func (r *Renderer) Load() error {
+	templates := map[string]*template.Template{}
+	if r.opts.FS == nil {
+		r.setTemplates(templates)
+		return nil
+	}
+
+	var layout string
+	if r.opts.Layout != "" {
+		buf, err := fs.ReadFile(r.opts.FS, "layouts/"+r.opts.Layout+r.opts.Extension)
+		if err != nil {
+			return fmt.Errorf("render: cannot read layout: %s", err)
+		}
+		layout = string(buf)
+	}
+
+	pages := map[string]string{}
+	partials := map[string]string{}
+	err := fs.WalkDir(r.opts.FS, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path == "layouts" {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != r.opts.Extension {
+			return nil
+		}
+		buf, err := fs.ReadFile(r.opts.FS, path)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(path, r.opts.Extension)
+		if strings.HasPrefix(name, "partials/") {
+			partials[name] = string(buf)
+		} else {
+			pages[name] = string(buf)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for name, page := range pages {
+		t, err := r.parse(name, layout, page, partials)
+		if err != nil {
+			return fmt.Errorf("render: cannot parse %s: %s", name, err)
+		}
+		templates[name] = t
+	}
+	r.setTemplates(templates)
+	return nil
+}
+
+// parse builds the template of a page with the partials, wrapped in
+// layout when it is set
+func (r *Renderer) parse(name, layout, page string, partials map[string]string) (*template.Template, error) {
+	root := page
+	if layout != "" {
+		root = layout
+	}
+	t, err := template.New(name).Funcs(r.opts.Funcs).Parse(root)
+	if err != nil {
+		return nil, err
+	}
+	if layout != "" {
+		if _, err := t.New("content").Parse(page); err != nil {
+			return nil, err
+		}
+	}
+	for pname, partial := range partials {
+		if _, err := t.New(pname).Parse(partial); err != nil {
+			return nil, fmt.Errorf("%s: %s", pname, err)
+		}
+	}
+	return t, nil
+}
+
+// HasTemplate reports whether the page template name exists
+func (r *Renderer) HasTemplate(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.templates[name]
+	return ok
+}
+
+func (r *Renderer) setTemplates(templates map[string]*template.Template) {
+	r.mu.Lock()
+	r.templates = templates
+	r.mu.Unlock()
+}
+
+// JSON writes v as JSON, indented when PrettyJSON is set
+func (r *Renderer) JSON(w http.ResponseWriter, status int, v interface{}) error {
+	if r.opts.PrettyJSON {
+		return r.PrettyJSON(w, status, v)
+	}
+	return r.jsonAs(w, status, mediaJSON, v, false)
+}
+
+// PrettyJSON writes v as indented JSON
+func (r *Renderer) PrettyJSON(w http.ResponseWriter, status int, v interface{}) error {
+	return r.jsonAs(w, status, mediaJSON, v, true)
+}
+
+// jsonAs writes v as JSON with the given content type
+func (r *Renderer) jsonAs(w http.ResponseWriter, status int, contentType string, v interface{}, pretty bool) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if pretty {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("render: error encoding JSON: %s", err)
+	}
+	return r.Data(w, status, contentType+charsetUTF, buf.Bytes())
+}
+
+// XML writes v as XML
+func (r *Renderer) XML(w http.ResponseWriter, status int, v interface{}) error {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := xml.NewEncoder(&buf).Encode(v); err != nil {
+		return fmt.Errorf("render: error encoding XML: %s", err)
+	}
+	return r.Data(w, status, mediaXML+charsetUTF, buf.Bytes())
+}
+
+// Text writes s as plain text
+func (r *Renderer) Text(w http.ResponseWriter, status int, s string) error {
+	return r.Data(w, status, mediaText+charsetUTF, []byte(s))
+}
+
+// HTML renders the page template name with data
+func (r *Renderer) HTML(w http.ResponseWriter, status int, name string, data interface{}) error {
+	if r.opts.Reload {
+		if err := r.Load(); err != nil {
+			return err
+		}
+	}
+	r.mu.RLock()
+	t, ok := r.templates[name]
+	r.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("render: no template %q", name)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return fmt.Errorf("render: error executing %s: %s", name, err)
+	}
+	return r.Data(w, status, mediaHTML+charsetUTF, buf.Bytes())
+}
+
+// Data writes body with the content type and status
+func (r *Renderer) Data(w http.ResponseWriter, status int, contentType string, body []byte) error {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	_, err := w.Write(body)
+	return err
+}
+
+// Negotiate writes v in the format preferred by the Accept header of req:
+// JSON, XML, plain text, or the page template name for HTML when name is
+// not empty. It defaults to JSON.
+func (r *Renderer) Negotiate(w http.ResponseWriter, req *http.Request, status int, name string, v interface{}) error {
+	offers := []string{mediaJSON, mediaXML, mediaText}
+	if name != "" {
+		offers = append(offers, mediaHTML)
+	}
+	w.Header().Add("Vary", "Accept")
+	switch negotiate(req.Header.Get("Accept"), offers) {
+	case mediaXML:
+		return r.XML(w, status, v)
+	case mediaText:
+		return r.Text(w, status, fmt.Sprint(v))
+	case mediaHTML:
+		return r.HTML(w, status, name, v)
+	default:
+		return r.JSON(w, status, v)
+	}
+}
+
+// acceptRange is one media range of an Accept header
+type acceptRange struct {
+	typ, subtype string
+	q            float64
+}
+
+// negotiate return the offer best matching the Accept header. Offers are
+// in order of server preference, the first is returned when nothing
+// matches or the header is empty.
+func negotiate(accept string, offers []string) string {
+	if accept == "" {
+		return offers[0]
+	}
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		typ, subtype, _ := strings.Cut(strings.ToLower(strings.TrimSpace(fields[0])), "/")
+		ar := acceptRange{typ: typ, subtype: subtype, q: 1}
+		for _, p := range fields[1:] {
+			k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if k == "q" {
+				if q, err := strconv.ParseFloat(v, 64); err == nil {
+					ar.q = q
+				}
+			}
+		}
+		ranges = append(ranges, ar)
+	}
+	// More specific ranges take precedence over wildcards
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return specificity(ranges[i]) > specificity(ranges[j])
+	})
+
+	best, bestQ := offers[0], 0.0
+	for _, offer := range offers {
+		typ, subtype, _ := strings.Cut(offer, "/")
+		for _, ar := range ranges {
+			if (ar.typ == "*" || ar.typ == typ) && (ar.subtype == "*" || ar.subtype == subtype) {
+				if ar.q > bestQ {
+					best, bestQ = offer, ar.q
+				}
+				break
+			}
+		}
+	}
+	return best
+}
+
+func specificity(ar acceptRange) int {
+	switch {
+	case ar.typ == "*":
+		return 0
+	case ar.subtype == "*":
+		return 1
+	}
+	return 2
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestNegotiate(t *testing.T) {
+	offers := []string{mediaJSON, mediaXML, mediaHTML}
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", mediaJSON},
+		{"*/*", mediaJSON},
+		{"application/xml", mediaXML},
+		{"text/html", mediaHTML},
+		{"TEXT/HTML", mediaHTML},
+		{"image/png", mediaJSON},
+		{"text/*", mediaHTML},
+		{"text/html;q=0.5, application/xml;q=0.8", mediaXML},
+		{"text/html, application/xml;q=0.9, */*;q=0.8", mediaHTML},
+		{"text/html;q=0.1, */*", mediaJSON},
+		{"application/json;q=0, application/xml;q=0.2", mediaXML},
+		{"text/html;level=1;q=0.9, application/json;q=0.3", mediaHTML},
+		{"text/html;q=bogus", mediaHTML},
+		// A browser
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", mediaHTML},
+	}
+	for _, tt := range tests {
+		if got := negotiate(tt.accept, offers); got != tt.want {
+			t.Errorf("negotiate(%q) = %s, want %s", tt.accept, got, tt.want)
+		}
+	}
+}
+
+// newTestRenderer return a renderer of a page template, "page"
+func newTestRenderer(t *testing.T) *Renderer {
+	t.Helper()
+	r, err := NewRenderer(RenderOptions{FS: fstest.MapFS{
+		"page.html": {Data: []byte(`<p>{{.Name}}</p>`)},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// renderItem is a value rendered in every format
+type renderItem struct {
+	Name string
+}
+
+func TestRendererNegotiate(t *testing.T) {
+	r := newTestRenderer(t)
+	v := renderItem{Name: "gopher"}
+	tests := []struct {
+		accept   string
+		name     string
+		wantType string
+		wantBody string
+	}{
+		{"", "page", mediaJSON, `{"Name":"gopher"}`},
+		{"application/xml", "page", mediaXML, `<renderItem><Name>gopher</Name></renderItem>`},
+		{"text/plain", "page", mediaText, `{gopher}`},
+		{"text/html", "page", mediaHTML, `<p>gopher</p>`},
+		// Without a page template HTML is not offered
+		{"text/html", "", mediaJSON, `{"Name":"gopher"}`},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		if err := r.Negotiate(w, req, http.StatusOK, tt.name, v); err != nil {
+			t.Errorf("negotiate %q: %s", tt.accept, err)
+			continue
+		}
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, tt.wantType) {
+			t.Errorf("negotiate %q: Content-Type = %q, want %s", tt.accept, ct, tt.wantType)
+		}
+		if !strings.Contains(w.Body.String(), tt.wantBody) {
+			t.Errorf("negotiate %q: body = %q, want %q", tt.accept, w.Body, tt.wantBody)
+		}
+		if w.Header().Get("Vary") != "Accept" {
+			t.Errorf("negotiate %q: Vary = %q", tt.accept, w.Header().Get("Vary"))
+		}
+	}
+}
+
+func TestErrorPages(t *testing.T) {
+	a, _ := newTestApp(t)
+	tests := []struct {
+		name     string
+		err      error
+		status   int
+		want     []string
+		dontWant []string
+	}{
+		{"internal", errors.New("db exploded"), 500,
+			[]string{"Something went wrong", "Request ID: <code>req-1</code>", "<title>Internal Server Error | base</title>"},
+			[]string{"db exploded"}},
+		{"not found", newAPIError(404, "no user", nil), 404,
+			[]string{"Page not found", "<code>/users/1</code>"}, nil},
+		{"client error", newAPIError(409, "email is already registered", nil), 409,
+			[]string{"<h1>409 Conflict</h1>", "<p>email is already registered</p>"}, nil},
+		{"escaped detail", newAPIError(400, "<script>", nil), 400,
+			[]string{"&lt;script&gt;"}, []string{"<script>"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/users/1", nil)
+			req.Header.Set("Accept", "text/html,*/*;q=0.8")
+			req = req.WithContext(context.WithValue(req.Context(), requestIDKey, "req-1"))
+			a.handleError(w, req, tt.err)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, mediaHTML) {
+				t.Errorf("Content-Type = %q, want %s", ct, mediaHTML)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(w.Body.String(), s) {
+					t.Errorf("page does not contain %q:\n%s", s, w.Body)
+				}
+			}
+			for _, s := range tt.dontWant {
+				if strings.Contains(w.Body.String(), s) {
+					t.Errorf("page contains %q:\n%s", s, w.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestErrorPageFallsBackToJSON(t *testing.T) {
+	a, log := newTestApp(t)
+	var err error
+	if a.rndr, err = NewRenderer(RenderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", mediaHTML)
+	a.handleError(w, req, newAPIError(409, "conflict", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, problemContentType) {
+		t.Errorf("Content-Type = %q, want %s", ct, problemContentType)
+	}
+	if w.Code != 409 || !strings.Contains(w.Body.String(), `"status":409`) {
+		t.Errorf("fallback = %d %s", w.Code, w.Body)
+	}
+	if !strings.Contains(log.String(), "error when rendering error page") {
+		t.Errorf("render failure not logged:\n%s", log)
+	}
+}
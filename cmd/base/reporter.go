@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"base"
+)
+
+// errorReportTimeout bounds the delivery of a report to an HTTP sink
+const errorReportTimeout = 5 * time.Second
+
+// ErrorReport describes a panic or a 5xx error with its request
+type ErrorReport struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id,omitempty"`
+	Method     string    `json:"method"`
+	URL        string    `json:"url"`
+	RemoteAddr string    `json:"remote_addr"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	UserID     uint64    `json:"user_id,omitempty"`
+	Status     int       `json:"status"`
+	Error      string    `json:"error"`
+	Panic      bool      `json:"panic,omitempty"`
+	Stack      string    `json:"stack,omitempty"`
+}
+
+// ErrorReporter receives the panics and 5xx errors of the app, e.g. to
+// forward them to an error tracking service
+type ErrorReporter interface {
+	Report(ctx context.Context, r *ErrorReport) error
+}
+
+// panicError is a recovered panic with the stack of the panicking goroutine
+type panicError struct {
+	value interface{}
+	stack []byte
+}
+
+// Error allows panicError to satisfy the error interface
+func (pe *panicError) Error() string {
+	return fmt.Sprintf("panic: %v", pe.value)
+}
+
+// newErrorReport return the report of err, which failed req with status
+func newErrorReport(req *http.Request, status int, err error) *ErrorReport {
+	r := &ErrorReport{
+		Time:       base.TimeNow(),
+		RequestID:  getRequestID(req),
+		Method:     req.Method,
+		URL:        req.URL.String(),
+		RemoteAddr: req.RemoteAddr,
+		UserAgent:  req.UserAgent(),
+		Status:     status,
+		Error:      err.Error(),
+	}
+	if u := getUser(req); u != nil {
+		r.UserID = u.ID
+	}
+	var pe *panicError
+	if errors.As(err, &pe) {
+		r.Panic = true
+		r.Stack = string(pe.stack)
+	}
+	return r
+}
+
+// fileReporter appends reports as JSON lines to a file
+type fileReporter struct {
+	mu   sync.Mutex
+	path string
+}
+
+// Report appends r to the file
+func (fr *fileReporter) Report(ctx context.Context, r *ErrorReport) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	f, err := os.OpenFile(fr.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// httpReporter posts reports as JSON to a URL
+type httpReporter struct {
+	url    string
+	client *http.Client
+}
+
+// Report posts r to the URL
+func (hr *httpReporter) Report(ctx context.Context, r *ErrorReport) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hr.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", mediaJSON)
+	resp, err := hr.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("error report rejected with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// multiReporter sends reports to every reporter
+type multiReporter []ErrorReporter
+
+// Report sends r to every reporter and return the first error
+func (mr multiReporter) Report(ctx context.Context, r *ErrorReport) error {
+	var first error
+	for _, rep := range mr {
+		if err := rep.Report(ctx, r); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// newErrorReporter return the reporter writing to file and posting to url,
+// either may be empty. It return nil when both are empty.
+func newErrorReporter(file, url string) ErrorReporter {
+	var mr multiReporter
+	if file != "" {
+		mr = append(mr, &fileReporter{path: file})
+	}
+	if url != "" {
+		mr = append(mr, &httpReporter{url: url, client: &http.Client{Timeout: errorReportTimeout}})
+	}
+	if len(mr) == 0 {
+		return nil
+	}
+	return mr
+}
+
+// errorReportQueueLen bounds the reports waiting for delivery
+const errorReportQueueLen = 64
+
+// queuedReport is a report waiting for delivery with the logger of its request
+type queuedReport struct {
+	report *ErrorReport
+	logr   appLogger
+}
+
+// reportQueue delivers reports to a reporter from a bounded queue with a
+// single worker, so an error storm cannot pile up goroutines. Reports
+// arriving while the queue is full are dropped and counted.
+type reportQueue struct {
+	reporter ErrorReporter
+	queue    chan queuedReport
+	done     chan struct{}
+	dropped  atomic.Uint64
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// newReportQueue return a queue of size delivering to reporter and starts
+// its worker. It return nil when reporter is nil.
+func newReportQueue(reporter ErrorReporter, size int) *reportQueue {
+	if reporter == nil {
+		return nil
+	}
+	q := &reportQueue{
+		reporter: reporter,
+		queue:    make(chan queuedReport, size),
+		done:     make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// run delivers the queued reports until the queue is closed
+func (q *reportQueue) run() {
+	defer close(q.done)
+	for qr := range q.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), errorReportTimeout)
+		if err := q.reporter.Report(ctx, qr.report); err != nil {
+			qr.logr.Error("error on reporting error", "err", err)
+		}
+		cancel()
+	}
+}
+
+// push queues r without blocking. It return false when r was dropped
+// because the queue is full or closed.
+func (q *reportQueue) push(r *ErrorReport, l appLogger) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		select {
+		case q.queue <- queuedReport{report: r, logr: l}:
+			return true
+		default:
+		}
+	}
+	q.dropped.Add(1)
+	return false
+}
+
+// Close stops accepting reports and waits for the queued ones to be
+// delivered, or for ctx to be done
+func (q *reportQueue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.queue)
+	}
+	q.mu.Unlock()
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reportError queues the report of err for the error reporter, so slow
+// sinks do not delay the response
+func (a *App) reportError(req *http.Request, status int, err error) {
+	if a.reports == nil {
+		return
+	}
+	l := a.log(req)
+	if !a.reports.push(newErrorReport(req, status, err), l) {
+		l.Warn("error report dropped, the report queue is full")
+	}
+}
+
+// waitReports waits for the queued reports before shutdown
+func (a *App) waitReports(ctx context.Context) error {
+	if a.reports == nil {
+		return nil
+	}
+	return a.reports.Close(ctx)
+}
+
+// writeReportMetrics writes the count of dropped error reports
+func (a *App) writeReportMetrics(mw *metricsWriter) {
+	if a.reports == nil {
+		return
+	}
+	mw.header("error_reports_dropped_total", "counter", "Total number of error reports dropped because the report queue was full.")
+	mw.sample("error_reports_dropped_total", nil, float64(a.reports.dropped.Load()))
+}
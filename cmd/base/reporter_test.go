@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordReporter records the reports it receives. When started is set,
+// Report signals it and then waits for release.
+type recordReporter struct {
+	mu      sync.Mutex
+	reports []*ErrorReport
+	started chan struct{}
+	release chan struct{}
+}
+
+// Report records r
+func (rr *recordReporter) Report(ctx context.Context, r *ErrorReport) error {
+	if rr.started != nil {
+		rr.started <- struct{}{}
+		<-rr.release
+	}
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.reports = append(rr.reports, r)
+	return nil
+}
+
+// count return the number of reports received
+func (rr *recordReporter) count() int {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	return len(rr.reports)
+}
+
+func TestReportQueueDropsWhenFull(t *testing.T) {
+	rr := &recordReporter{started: make(chan struct{}, 2), release: make(chan struct{})}
+	q := newReportQueue(rr, 1)
+	logr, _ := newLogger(&strings.Builder{}, "", "info")
+
+	if !q.push(&ErrorReport{Error: "first"}, logr) {
+		t.Fatal("first report dropped")
+	}
+	<-rr.started // the worker holds the first report
+	if !q.push(&ErrorReport{Error: "queued"}, logr) {
+		t.Fatal("second report dropped with room in the queue")
+	}
+	if q.push(&ErrorReport{Error: "dropped"}, logr) {
+		t.Fatal("report queued in a full queue")
+	}
+	if got := q.dropped.Load(); got != 1 {
+		t.Errorf("dropped = %d, want 1", got)
+	}
+
+	close(rr.release)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := q.Close(ctx); err != nil {
+		t.Fatalf("close: %s", err)
+	}
+	if got := rr.count(); got != 2 {
+		t.Errorf("delivered %d reports, want 2", got)
+	}
+	if q.push(&ErrorReport{Error: "late"}, logr) {
+		t.Error("report queued after close")
+	}
+	if got := q.dropped.Load(); got != 2 {
+		t.Errorf("dropped after close = %d, want 2", got)
+	}
+}
+
+func TestNewReportQueueWithoutReporter(t *testing.T) {
+	if q := newReportQueue(nil, 1); q != nil {
+		t.Errorf("queue without reporter = %v, want nil", q)
+	}
+	a := &App{}
+	a.reportError(httptest.NewRequest("GET", "/", nil), 500, http.ErrBodyNotAllowed)
+	if err := a.waitReports(context.Background()); err != nil {
+		t.Errorf("wait without reporter: %s", err)
+	}
+}
+
+func TestRecoverHandler(t *testing.T) {
+	a, log := newTestApp(t)
+	rr := &recordReporter{}
+	a.reports = newReportQueue(rr, 1)
+	r := NewRouter()
+	public := r.Group("", a.requestID, a.recoverHandler)
+	public.Get("/panic", a.Wrap(func(w http.ResponseWriter, req *http.Request) error {
+		panic("secret value")
+	}))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/panic", nil)
+	req.Header.Set("Accept", mediaJSON)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, problemContentType) {
+		t.Errorf("Content-Type = %q, want %s", ct, problemContentType)
+	}
+	var p Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode problem: %s", err)
+	}
+	if p.Status != 500 || p.Title != "Internal Server Error" || p.Instance != "/panic" || p.RequestID == "" {
+		t.Errorf("problem = %+v", p)
+	}
+	if strings.Contains(w.Body.String(), "secret value") {
+		t.Errorf("panic value leaked in %s", w.Body)
+	}
+
+	if n := strings.Count(log.String(), "secret value"); n != 1 {
+		t.Errorf("panic logged %d times, want once:\n%s", n, log)
+	}
+	if !strings.Contains(log.String(), "stack=") {
+		t.Errorf("panic logged without its stack:\n%s", log)
+	}
+	if err := a.waitReports(context.Background()); err != nil {
+		t.Fatalf("wait reports: %s", err)
+	}
+	if rr.count() != 1 || !rr.reports[0].Panic || rr.reports[0].Stack == "" || rr.reports[0].Status != 500 {
+		t.Errorf("reports = %+v", rr.reports)
+	}
+}
+
+func TestRecoverHandlerAbort(t *testing.T) {
+	a, _ := newTestApp(t)
+	h := a.recoverHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want %v", err, http.ErrAbortHandler)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	t.Error("abort panic was swallowed")
+}
@@ -79,6 +79,11 @@ func (rw *responseWriter) callBefore() {
 	}
 }
 
+// Unwrap return the wrapped writer, for http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func (rw *responseWriter) Flush() {
 	flusher, ok := rw.ResponseWriter.(http.Flusher)
 	if ok {
@@ -1,70 +1,112 @@
 package main
 
 import (
+	"context"
 	"net/http"
 
-	"github.com/gorilla/context"
 	"github.com/julienschmidt/httprouter"
+	"github.com/justinas/alice"
 )
 
 // Router is a wrapper around httprouter
 // Here we reimplement the type requests, but with a
 // wrapHandler
+//
+// A Router may be a group of another router: it shares the routing table
+// and adds its path prefix and middleware chain to every route.
 type Router struct {
 	*httprouter.Router
+	prefix string
+	chain  alice.Chain
+	routes *routeTable
 }
 
 // NewRouter return a new router
 func NewRouter() *Router {
-	return &Router{httprouter.New()}
+	return &Router{Router: httprouter.New(), routes: newRouteTable()}
 }
 
-// Params ...
-const Params = "params"
+// Group return a sub-router whose routes are prefixed with prefix and run
+// through mw after the middleware of r. Groups can be nested.
+func (r *Router) Group(prefix string, mw ...alice.Constructor) *Router {
+	return &Router{
+		Router: r.Router,
+		prefix: r.prefix + prefix,
+		chain:  r.chain.Append(mw...),
+		routes: r.routes,
+	}
+}
+
+// Chain return the middleware chain of the router
+func (r *Router) Chain() alice.Chain {
+	return r.chain
+}
+
+// handle registers handler for method and the prefixed path, behind the
+// router middleware followed by the per-route mw
+func (r *Router) handle(method, path string, handler http.Handler, mw []alice.Constructor) *Route {
+	r.Handle(method, r.prefix+path, wrapHandler(r.prefix+path, r.chain.Append(mw...).Then(handler)))
+	return r.routes.add(method, r.prefix+path)
+}
 
 // wrapHandler turns a normal http.Handler into a httprouter compatible
-// handler. We use gorilla/context to save params instead.
-// This incurs a small performance hit, but it allows us to conform to the
-// http.Handler interface.
-func wrapHandler(next http.Handler) httprouter.Handle {
+// handler. The params and the route pattern are saved in the request
+// context, see params and routePattern.
+func wrapHandler(pattern string, next http.Handler) httprouter.Handle {
 	return func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
-		context.Set(req, Params, ps)
+		ctx := context.WithValue(req.Context(), paramsKey, ps)
+		req = req.WithContext(context.WithValue(ctx, routeKey, pattern))
 		// Use our own ResponseWriter wrapper in order to capture response data.
 		next.ServeHTTP(NewResponseWriter(w), req)
 	}
 }
 
+// routePattern return the pattern of the route matching req, e.g.
+// /users/:id, or "" when no route matches
+func routePattern(req *http.Request) string {
+	pattern, _ := req.Context().Value(routeKey).(string)
+	return pattern
+}
+
+// wrapResponse turns a normal http.Handler into one that uses our
+// ResponseWriter, for handlers the router calls directly such as NotFound.
+func wrapResponse(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		next.ServeHTTP(NewResponseWriter(w), req)
+	})
+}
+
 // Get presenter for GET
-func (r *Router) Get(path string, handler http.Handler) {
-	r.GET(path, wrapHandler(handler))
+func (r *Router) Get(path string, handler http.Handler, mw ...alice.Constructor) *Route {
+	return r.handle(http.MethodGet, path, handler, mw)
 }
 
 // Post presenter for POST
-func (r *Router) Post(path string, handler http.Handler) {
-	r.POST(path, wrapHandler(handler))
+func (r *Router) Post(path string, handler http.Handler, mw ...alice.Constructor) *Route {
+	return r.handle(http.MethodPost, path, handler, mw)
 }
 
 // Put presenter for PUT
-func (r *Router) Put(path string, handler http.Handler) {
-	r.PUT(path, wrapHandler(handler))
+func (r *Router) Put(path string, handler http.Handler, mw ...alice.Constructor) *Route {
+	return r.handle(http.MethodPut, path, handler, mw)
 }
 
 // Patch presenter for PATCH
-func (r *Router) Patch(path string, handler http.Handler) {
-	r.PATCH(path, wrapHandler(handler))
+func (r *Router) Patch(path string, handler http.Handler, mw ...alice.Constructor) *Route {
+	return r.handle(http.MethodPatch, path, handler, mw)
 }
 
 // Delete presenter for DELETE
-func (r *Router) Delete(path string, handler http.Handler) {
-	r.DELETE(path, wrapHandler(handler))
+func (r *Router) Delete(path string, handler http.Handler, mw ...alice.Constructor) *Route {
+	return r.handle(http.MethodDelete, path, handler, mw)
 }
 
 // Head presenter for HEAD
-func (r *Router) Head(path string, handler http.Handler) {
-	r.HEAD(path, wrapHandler(handler))
+func (r *Router) Head(path string, handler http.Handler, mw ...alice.Constructor) *Route {
+	return r.handle(http.MethodHead, path, handler, mw)
 }
 
 // Options presenter for OPTIONS
-func (r *Router) Options(path string, handler http.Handler) {
-	r.OPTIONS(path, wrapHandler(handler))
+func (r *Router) Options(path string, handler http.Handler, mw ...alice.Constructor) *Route {
+	return r.handle(http.MethodOptions, path, handler, mw)
 }
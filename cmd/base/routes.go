@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/pflag"
+
+	"base"
+)
+
+// setupRoutes registers every route of the app on r, split into public,
+// authenticated and admin route trees
+func (a *App) setupRoutes(r *Router, db *base.DB) {
+	public := r.Group("", a.requestID, a.metricsHandler, a.loggingHandler, a.recoverHandler)
+	authed := public.Group("", a.requireAuth)
+	admin := public.Group("/admin", a.requireAdmin)
+
+	r.NotFound = wrapResponse(public.Chain().Then(a.Wrap(a.NotFoundHandler())))
+	r.MethodNotAllowed = wrapResponse(public.Chain().Then(a.Wrap(a.MethodNotAllowedHandler())))
+
+	public.Post("/", a.Wrap(a.IndexHandler(db))).Name("index")
+	public.Post("/register", a.Wrap(a.RegisterHandler(db)), a.optionalAuth).Name("register")
+	public.Post("/login", a.Wrap(a.LoginHandler(db)), a.optionalAuth).Name("login")
+	public.Post("/logout", a.Wrap(a.LogoutHandler(db)), a.optionalAuth).Name("logout")
+	public.Get("/metrics", a.Wrap(a.MetricsHandler(db))).Name("metrics")
+	public.Get("/healthz", a.Wrap(a.HealthzHandler())).Name("healthz")
+	public.Get("/readyz", a.Wrap(a.ReadyzHandler())).Name("readyz")
+
+	authed.Get("/me", a.Wrap(a.MeHandler(db))).Name("me")
+
+	admin.Get("/backup", a.Wrap(a.BackupHandler(db))).Name("admin.backup")
+	admin.Get("/users", a.Wrap(a.UserListHandler(db))).Name("admin.users")
+}
+
+const routesUsage = `usage: base routes
+
+Print the routing table of the app.
+`
+
+// runRoutes runs the routes command and return the process exit code
+func runRoutes(args []string) int {
+	fs := pflag.NewFlagSet("routes", pflag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, routesUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsageError
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return exitUsageError
+	}
+
+	// Registering routes only builds handlers, it needs no db or config
+	a := &App{}
+	r := NewRouter()
+	a.router = r
+	a.setupRoutes(r, nil)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "METHOD\tPATH\tNAME")
+	for _, rt := range r.Routes() {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", rt.Method, rt.Path, rt.RouteName())
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "error on printing routes: %s\n", err)
+		return exitCommandError
+	}
+	return exitOK
+}
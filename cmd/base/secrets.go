@@ -0,0 +1,319 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// keyfilePassphraseEnv holds the passphrase of the encrypted keyfile. It is
+// only read from the environment, never from the config.
+const keyfilePassphraseEnv = envPrefix + "_KEYFILE_PASSPHRASE"
+
+// Keyfile encryption parameters
+const (
+	keyfileVersion    = 1
+	keyfileIterations = 600000
+	// keyfileMaxIterations bounds the iterations read from a keyfile, so a
+	// corrupt keyfile cannot hang the startup
+	keyfileMaxIterations = 10 * keyfileIterations
+	keyfileSaltLen       = 16
+	keyfileKeyLen        = 32
+)
+
+// developmentCookieSecret signs cookies in development when no cookie
+// secret is configured. It is refused outside development.
+const developmentCookieSecret = "development-cookie-secret-do-not-use-in-production"
+
+// defaultSecrets are secrets known to the public, refused outside development
+var defaultSecrets = []string{
+	developmentCookieSecret,
+	// Shipped in the sample config of earlier releases
+	"@%3V?#ay!ONfzV7N&3|{?[YT6-gDHgZIhP_;qaw5e7i3t`SAT)w&+GO*>w2EX+[5",
+}
+
+// ErrSecretNotFound for a secret reference naming no secret
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretProvider resolves the secrets of one reference scheme. A secret
+// setting may hold a reference, scheme:name, instead of the secret itself:
+//
+//	env:SESSION_KEY           the environment variable SESSION_KEY
+//	file:/run/secrets/key     the content of a file, e.g. a Docker or
+//	                          Kubernetes secret mount
+//	keyfile:cookieSecret      an entry of the encrypted keyfile
+//
+// Values without a known scheme are used as is.
+type SecretProvider interface {
+	Secret(name string) (string, error)
+}
+
+// envSecrets resolves secrets from environment variables
+type envSecrets struct{}
+
+// Secret return the environment variable name
+func (envSecrets) Secret(name string) (string, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return "", ErrSecretNotFound
+	}
+	return v, nil
+}
+
+// fileSecrets resolves secrets from files, without trailing newlines
+type fileSecrets struct{}
+
+// Secret return the content of the file name
+func (fileSecrets) Secret(name string) (string, error) {
+	buf, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return "", ErrSecretNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(buf), "\r\n"), nil
+}
+
+// keyfileSecrets resolves secrets from a keyfile encrypted with AES-GCM
+// under a key derived from a passphrase
+type keyfileSecrets struct {
+	path       string
+	passphrase string
+
+	once    sync.Once
+	secrets map[string]string
+	err     error
+}
+
+// keyfileData is the stored form of a keyfile
+type keyfileData struct {
+	Version    int    `json:"version"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+// Secret return the keyfile entry name. The keyfile is decrypted once.
+func (ks *keyfileSecrets) Secret(name string) (string, error) {
+	ks.once.Do(func() {
+		ks.secrets, ks.err = readKeyfile(ks.path, ks.passphrase)
+	})
+	if ks.err != nil {
+		return "", ks.err
+	}
+	v, ok := ks.secrets[name]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return v, nil
+}
+
+// readKeyfile decrypts the keyfile at path. A missing keyfile has no entries.
+func readKeyfile(path, passphrase string) (map[string]string, error) {
+	buf, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if passphrase == "" {
+		return nil, fmt.Errorf("keyfile: $%s is not set", keyfilePassphraseEnv)
+	}
+	var kd keyfileData
+	if err := json.Unmarshal(buf, &kd); err != nil {
+		return nil, fmt.Errorf("keyfile: %s", err)
+	}
+	if kd.Version != keyfileVersion {
+		return nil, fmt.Errorf("keyfile: unsupported version %d", kd.Version)
+	}
+	if kd.Iterations < keyfileIterations || kd.Iterations > keyfileMaxIterations {
+		return nil, fmt.Errorf("keyfile: iterations must be between %d and %d, got %d", keyfileIterations, keyfileMaxIterations, kd.Iterations)
+	}
+	if len(kd.Salt) < keyfileSaltLen {
+		return nil, fmt.Errorf("keyfile: salt must have at least %d bytes", keyfileSaltLen)
+	}
+	gcm, err := keyfileCipher(passphrase, kd.Salt, kd.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, kd.Nonce, kd.Data, nil)
+	if err != nil {
+		return nil, errors.New("keyfile: wrong passphrase or corrupt keyfile")
+	}
+	secrets := map[string]string{}
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, fmt.Errorf("keyfile: %s", err)
+	}
+	return secrets, nil
+}
+
+// writeKeyfile encrypts secrets into the keyfile at path, with a new salt
+func writeKeyfile(path, passphrase string, secrets map[string]string) error {
+	if passphrase == "" {
+		return fmt.Errorf("keyfile: $%s is not set", keyfilePassphraseEnv)
+	}
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	kd := keyfileData{Version: keyfileVersion, Iterations: keyfileIterations, Salt: make([]byte, keyfileSaltLen)}
+	if _, err := rand.Read(kd.Salt); err != nil {
+		return err
+	}
+	gcm, err := keyfileCipher(passphrase, kd.Salt, kd.Iterations)
+	if err != nil {
+		return err
+	}
+	kd.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(kd.Nonce); err != nil {
+		return err
+	}
+	kd.Data = gcm.Seal(nil, kd.Nonce, plain, nil)
+	buf, err := json.MarshalIndent(kd, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(buf, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// keyfileCipher return the AES-GCM cipher of a passphrase
+func keyfileCipher(passphrase string, salt []byte, iter int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iter, keyfileKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// secretProviders return the providers by scheme, reading the keyfile at
+// keyfile
+func secretProviders(keyfile string) map[string]SecretProvider {
+	providers := map[string]SecretProvider{
+		"env":  envSecrets{},
+		"file": fileSecrets{},
+	}
+	if keyfile != "" {
+		providers["keyfile"] = &keyfileSecrets{path: keyfile, passphrase: os.Getenv(keyfilePassphraseEnv)}
+	}
+	return providers
+}
+
+// resolveSecret return the secret referenced by value, or value itself when
+// it is not a reference
+func resolveSecret(providers map[string]SecretProvider, value string) (string, error) {
+	scheme, name, ok := strings.Cut(value, ":")
+	if !ok {
+		return value, nil
+	}
+	p, ok := providers[scheme]
+	if !ok {
+		return value, nil
+	}
+	secret, err := p.Secret(name)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", value, err)
+	}
+	return secret, nil
+}
+
+const secretsUsage = `usage: base secrets [flags] list | set NAME | delete NAME
+
+Manage the secrets of the encrypted keyfile. set reads the secret from
+stdin. The passphrase is read from $` + keyfilePassphraseEnv + `.
+`
+
+// runSecrets runs the secrets command managing the encrypted keyfile and
+// return the process exit code
+func runSecrets(pwd string, args []string) int {
+	fs := pflag.NewFlagSet("secrets", pflag.ContinueOnError)
+	fs.String("config", "", "config file, $"+envPrefix+"_CONFIG")
+	fs.String("keyfile", "", "encrypted keyfile, $"+envPrefix+"_KEYFILE")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, secretsUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsageError
+	}
+	args = fs.Args()
+	if len(args) == 0 {
+		fs.Usage()
+		return exitUsageError
+	}
+	// The secrets the config may not resolve yet are managed here, so the
+	// config is read but not validated
+	if err := readConfiguration(pwd, fs); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsageError
+	}
+	keyfile := viper.GetString("keyfile")
+	if keyfile == "" {
+		fmt.Fprintln(os.Stderr, "secrets: keyfile is not configured")
+		return exitUsageError
+	}
+	passphrase := os.Getenv(keyfilePassphraseEnv)
+	secrets, err := readKeyfile(keyfile, passphrase)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "secrets: %s\n", err)
+		return exitCommandError
+	}
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		names := make([]string, 0, len(secrets))
+		for name := range secrets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return exitOK
+	case args[0] == "set" && len(args) == 2:
+		buf, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "secrets: %s\n", err)
+			return exitCommandError
+		}
+		secrets[args[1]] = strings.TrimRight(string(buf), "\r\n")
+	case args[0] == "delete" && len(args) == 2:
+		if _, ok := secrets[args[1]]; !ok {
+			fmt.Fprintf(os.Stderr, "secrets: no secret %q\n", args[1])
+			return exitCommandError
+		}
+		delete(secrets, args[1])
+	default:
+		fs.Usage()
+		return exitUsageError
+	}
+
+	if err := writeKeyfile(keyfile, passphrase, secrets); err != nil {
+		fmt.Fprintf(os.Stderr, "secrets: %s\n", err)
+		return exitCommandError
+	}
+	return exitOK
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"base"
+)
+
+func TestKeyfileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyfile")
+	want := map[string]string{"cookieSecret": "s3cret", "adminToken": "t0ken"}
+	if err := writeKeyfile(path, "passphrase", want); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	got, err := readKeyfile(path, "passphrase")
+	if err != nil {
+		t.Fatalf("read: %s", err)
+	}
+	if len(got) != len(want) || got["cookieSecret"] != "s3cret" || got["adminToken"] != "t0ken" {
+		t.Errorf("secrets = %v, want %v", got, want)
+	}
+
+	if _, err := readKeyfile(path, "wrong"); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Errorf("read with a wrong passphrase = %v", err)
+	}
+	if _, err := readKeyfile(path, ""); err == nil || !strings.Contains(err.Error(), keyfilePassphraseEnv) {
+		t.Errorf("read without passphrase = %v", err)
+	}
+	if got, err := readKeyfile(path+".missing", "passphrase"); err != nil || len(got) != 0 {
+		t.Errorf("read missing keyfile = %v, %v", got, err)
+	}
+}
+
+func TestKeyfileRejectsTamperedParameters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyfile")
+	if err := writeKeyfile(path, "passphrase", map[string]string{"a": "b"}); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kd keyfileData
+	if err := json.Unmarshal(buf, &kd); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		edit func(kd *keyfileData)
+		want string
+	}{
+		{"weak iterations", func(kd *keyfileData) { kd.Iterations = 1 }, "iterations"},
+		{"huge iterations", func(kd *keyfileData) { kd.Iterations = 1 << 40 }, "iterations"},
+		{"short salt", func(kd *keyfileData) { kd.Salt = kd.Salt[:4] }, "salt"},
+		{"version", func(kd *keyfileData) { kd.Version = 2 }, "version"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := kd
+			tt.edit(&tampered)
+			buf, err := json.Marshal(tampered)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := filepath.Join(t.TempDir(), "keyfile")
+			if err := os.WriteFile(p, buf, 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := readKeyfile(p, "passphrase"); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("read = %v, want an error on %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveSecret(t *testing.T) {
+	dir := t.TempDir()
+	keyfile := filepath.Join(dir, "keyfile")
+	if err := writeKeyfile(keyfile, "passphrase", map[string]string{"cookieSecret": "from keyfile"}); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	secretFile := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secretFile, []byte("from file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(keyfilePassphraseEnv, "passphrase")
+	t.Setenv("TEST_SECRET", "from env")
+	providers := secretProviders(keyfile)
+
+	tests := []struct {
+		value   string
+		want    string
+		wantErr error
+	}{
+		{"plain value", "plain value", nil},
+		{"env:TEST_SECRET", "from env", nil},
+		{"env:TEST_MISSING_SECRET", "", ErrSecretNotFound},
+		{"file:" + secretFile, "from file", nil},
+		{"file:" + secretFile + ".missing", "", ErrSecretNotFound},
+		{"keyfile:cookieSecret", "from keyfile", nil},
+		{"keyfile:missing", "", ErrSecretNotFound},
+		{"vault:cookieSecret", "vault:cookieSecret", nil},
+		{"https://example.com", "https://example.com", nil},
+	}
+	for _, tt := range tests {
+		got, err := resolveSecret(providers, tt.value)
+		if tt.wantErr != nil {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr.Error()) {
+				t.Errorf("resolve %q = %q, %v, want %v", tt.value, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("resolve %q = %q, %v, want %q", tt.value, got, err, tt.want)
+		}
+	}
+
+	// Without a keyfile, keyfile: is not a known scheme
+	if got, err := resolveSecret(secretProviders(""), "keyfile:cookieSecret"); err != nil || got != "keyfile:cookieSecret" {
+		t.Errorf("resolve without keyfile = %q, %v", got, err)
+	}
+}
+
+func TestValidateSecrets(t *testing.T) {
+	strong := strings.Repeat("n", minCookieSecretLen)
+	tests := []struct {
+		name     string
+		dev      bool
+		secret   string
+		previous []string
+		wantErr  bool
+	}{
+		{"strong", false, strong, nil, false},
+		{"short", false, "short", nil, true},
+		{"development default", false, developmentCookieSecret, nil, true},
+		{"sample default", false, defaultSecrets[1], nil, true},
+		{"default previous", false, strong, []string{developmentCookieSecret}, true},
+		{"rotation", false, strong, []string{strings.Repeat("o", minCookieSecretLen)}, false},
+		{"development", true, developmentCookieSecret, nil, false},
+		{"short in development", true, "short", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := defaultConfig("/srv/base")
+			c.IsDevelopment, c.CookieSecret, c.previousSecrets = tt.dev, tt.secret, tt.previous
+			err := c.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "cookieSecret") {
+				t.Errorf("validate = %v, want an error on cookieSecret", err)
+			}
+		})
+	}
+}
+
+func TestPreviousCookieSecretsVerify(t *testing.T) {
+	a, _ := newTestApp(t)
+	oldSecret, newSecret := strings.Repeat("o", minCookieSecretLen), strings.Repeat("n", minCookieSecretLen)
+	t.Setenv("TEST_OLD_SECRET", oldSecret)
+	c := baseConfig{CookieSecret: newSecret, PrevSecrets: "env:TEST_OLD_SECRET"}
+	if err := c.resolveSecrets(); err != nil {
+		t.Fatalf("resolve: %s", err)
+	}
+
+	old := base.NewSessionStore(a.db, []byte(oldSecret), time.Hour)
+	s, err := old.New(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := old.Save(s); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(old.Cookie(s))
+
+	rotated := base.NewSessionStore(a.db, []byte(c.CookieSecret), time.Hour, c.previousCookieSecrets()...)
+	if got, err := rotated.Load(req); err != nil || got.ID != s.ID {
+		t.Errorf("load with the previous secret = %v, %v", got, err)
+	}
+	if _, err := base.NewSessionStore(a.db, []byte(newSecret), time.Hour).Load(req); err == nil {
+		t.Error("load without the previous secret did not fail")
+	}
+}
+
+func TestResolveSecretsErrors(t *testing.T) {
+	c := baseConfig{CookieSecret: "env:TEST_MISSING_SECRET"}
+	if err := c.resolveSecrets(); err == nil || !strings.Contains(err.Error(), "cookieSecret") {
+		t.Errorf("resolve = %v, want an error on cookieSecret", err)
+	}
+}
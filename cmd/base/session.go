@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// defaultSessionExpiry is the session lifetime when sessionExpiry is not configured
+const defaultSessionExpiry = 4 * time.Hour
+
+// sessionSweepInterval is how often expired sessions are deleted
+const sessionSweepInterval = 10 * time.Minute
+
+// startSessionSweeper starts deleting expired sessions in the background
+func (a *App) startSessionSweeper() error {
+	a.sessions.StartSweeper(sessionSweepInterval, func(err error) {
+		a.logr.Error("error on sweeping sessions", "err", err)
+	})
+	return nil
+}
+
+// stopSessionSweeper stops the session sweeper before the db is closed
+func (a *App) stopSessionSweeper(ctx context.Context) error {
+	a.sessions.Close()
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+)
+
+// embeddedTemplates are the default templates, used when the template
+// directory does not exist
+//
+//go:embed templates
+var embeddedTemplates embed.FS
+
+// templateFS return the templates of dir when it exists, otherwise the
+// embedded templates
+func templateFS(dir string) (fs.FS, error) {
+	if dir != "" {
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			return os.DirFS(dir), nil
+		}
+	}
+	return fs.Sub(embeddedTemplates, "templates")
+}
+
+// templateFuncs return the functions available to every template
+func (a *App) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		// url builds the path of a named route, e.g. {{url "me"}}
+		"url": func(name string, params ...string) (string, error) {
+			if a.router == nil {
+				return "", fmt.Errorf("no router for route %q", name)
+			}
+			return a.router.URL(name, params...)
+		},
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Route is a registered route. Naming a route makes it available to
+// Router.URL.
+type Route struct {
+	Method string
+	Path   string
+	name   string
+	table  *routeTable
+}
+
+// routeTable records the routes of a router and its groups
+type routeTable struct {
+	mu     sync.RWMutex
+	all    []*Route
+	byName map[string]*Route
+}
+
+func newRouteTable() *routeTable {
+	return &routeTable{byName: map[string]*Route{}}
+}
+
+// add records a route
+func (t *routeTable) add(method, path string) *Route {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	rt := &Route{Method: method, Path: path, table: t}
+	t.all = append(t.all, rt)
+	return rt
+}
+
+// Name sets the route name used to build its URL. Names are unique and
+// registering one twice panics, like registering a path twice does.
+func (rt *Route) Name(name string) *Route {
+	rt.table.mu.Lock()
+	defer rt.table.mu.Unlock()
+	if other, ok := rt.table.byName[name]; ok {
+		panic(fmt.Sprintf("route name %q already used by %s %s", name, other.Method, other.Path))
+	}
+	rt.name = name
+	rt.table.byName[name] = rt
+	return rt
+}
+
+// RouteName return the name of the route, or "" when it has none
+func (rt *Route) RouteName() string {
+	return rt.name
+}
+
+// Routes return every registered route in registration order
+func (r *Router) Routes() []*Route {
+	r.routes.mu.RLock()
+	defer r.routes.mu.RUnlock()
+	return append([]*Route(nil), r.routes.all...)
+}
+
+// URL builds the path of the named route. params are name/value pairs
+// for the route's :param and *catchall segments, e.g.
+// URL("user", "id", "42"). Every segment must be given a value.
+func (r *Router) URL(name string, params ...string) (string, error) {
+	r.routes.mu.RLock()
+	rt, ok := r.routes.byName[name]
+	r.routes.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("url: no route named %q", name)
+	}
+	return rt.URL(params...)
+}
+
+// URL builds the path of the route from name/value pairs
+func (rt *Route) URL(params ...string) (string, error) {
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("url: route %q: params must be name/value pairs", rt.name)
+	}
+	values := make(map[string]string, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		values[params[i]] = params[i+1]
+	}
+
+	segments := strings.Split(rt.Path, "/")
+	for i, seg := range segments {
+		if seg == "" || (seg[0] != ':' && seg[0] != '*') {
+			continue
+		}
+		key := seg[1:]
+		v, ok := values[key]
+		if !ok {
+			return "", fmt.Errorf("url: route %q: missing parameter %q", rt.name, key)
+		}
+		delete(values, key)
+		if seg[0] == ':' {
+			if v == "" {
+				return "", fmt.Errorf("url: route %q: empty parameter %q", rt.name, key)
+			}
+			segments[i] = url.PathEscape(v)
+			continue
+		}
+		// A catch-all value spans segments and, like httprouter gives it,
+		// may start with a slash
+		parts := strings.Split(strings.TrimPrefix(v, "/"), "/")
+		for j, p := range parts {
+			parts[j] = url.PathEscape(p)
+		}
+		segments[i] = strings.Join(parts, "/")
+	}
+	for key := range values {
+		return "", fmt.Errorf("url: route %q: unknown parameter %q", rt.name, key)
+	}
+	return strings.Join(segments, "/"), nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+// urlRouter return a router with named routes in the root and in a group
+func urlRouter() *Router {
+	r := NewRouter()
+	h := http.NotFoundHandler()
+	r.Get("/", h).Name("home")
+	r.Get("/users/:id", h).Name("user")
+	r.Get("/users/:id/posts/:post", h).Name("post")
+	r.Get("/files/*path", h).Name("file")
+	r.Group("/admin").Get("/users/:id", h).Name("admin.user")
+	r.Get("/unnamed", h)
+	return r
+}
+
+func TestRouterURL(t *testing.T) {
+	r := urlRouter()
+	tests := []struct {
+		name   string
+		params []string
+		want   string
+	}{
+		{"home", nil, "/"},
+		{"user", []string{"id", "42"}, "/users/42"},
+		{"user", []string{"id", "a b/c"}, "/users/a%20b%2Fc"},
+		{"post", []string{"post", "7", "id", "1"}, "/users/1/posts/7"},
+		{"file", []string{"path", "/css/site.css"}, "/files/css/site.css"},
+		{"file", []string{"path", "a b/c"}, "/files/a%20b/c"},
+		{"admin.user", []string{"id", "3"}, "/admin/users/3"},
+	}
+	for _, tt := range tests {
+		got, err := r.URL(tt.name, tt.params...)
+		if err != nil || got != tt.want {
+			t.Errorf("URL(%q, %q) = %q, %v, want %q", tt.name, tt.params, got, err, tt.want)
+		}
+	}
+}
+
+func TestRouterURLErrors(t *testing.T) {
+	r := urlRouter()
+	tests := []struct {
+		name   string
+		params []string
+	}{
+		{"nope", nil},
+		{"user", nil},
+		{"user", []string{"id"}},
+		{"user", []string{"id", ""}},
+		{"user", []string{"id", "1", "extra", "2"}},
+		{"post", []string{"id", "1"}},
+	}
+	for _, tt := range tests {
+		if got, err := r.URL(tt.name, tt.params...); err == nil {
+			t.Errorf("URL(%q, %q) = %q, want an error", tt.name, tt.params, got)
+		}
+	}
+}
+
+func TestRouteNameUnique(t *testing.T) {
+	r := urlRouter()
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a name twice did not panic")
+		}
+	}()
+	r.Get("/other", http.NotFoundHandler()).Name("user")
+}
+
+func TestRouterRoutes(t *testing.T) {
+	routes := urlRouter().Routes()
+	if len(routes) != 6 {
+		t.Fatalf("routes = %d, want 6", len(routes))
+	}
+	if rt := routes[4]; rt.Method != "GET" || rt.Path != "/admin/users/:id" || rt.RouteName() != "admin.user" {
+		t.Errorf("group route = %+v", rt)
+	}
+	if routes[5].RouteName() != "" {
+		t.Errorf("unnamed route name = %q", routes[5].RouteName())
+	}
+}
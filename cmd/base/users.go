@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"golang.org/x/term"
+
+	"base"
+)
+
+const userUsage = `usage: base user <command> --email EMAIL [--name NAME]
+
+commands:
+  create            create a user, reading the password from stdin
+  reset-password    set the password of a user, reading it from stdin,
+                    and log out every session of the user
+`
+
+// runUser runs the user command and return the process exit code
+func runUser(pwd string, args []string) int {
+	fs := pflag.NewFlagSet("user", pflag.ContinueOnError)
+	email := fs.String("email", "", "email of the user")
+	name := fs.String("name", "", "name of the user, for create")
+	commandFlags(fs, pwd)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, userUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsageError
+	}
+	if fs.NArg() != 1 || *email == "" || (fs.Arg(0) != "create" && fs.Arg(0) != "reset-password") {
+		fs.Usage()
+		return exitUsageError
+	}
+
+	db, code := openCommandDB(pwd, fs, false)
+	if db == nil {
+		return code
+	}
+	defer closeDB(db)
+
+	password, err := readPassword()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error on reading password: %s\n", err)
+		return exitCommandError
+	}
+	// The same rules as the register endpoint
+	fields, err := validate(&registerRequest{Email: *email, Password: password, Name: *name})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error on validating user: %s\n", err)
+		return exitCommandError
+	}
+	if len(fields) > 0 {
+		for _, f := range fields {
+			fmt.Fprintf(os.Stderr, "%s %s\n", f.Field, f.Message)
+		}
+		return exitUsageError
+	}
+
+	switch fs.Arg(0) {
+	case "create":
+		u := &base.User{Email: *email, Name: *name}
+		if err := db.Users().Create(u, password); err != nil {
+			fmt.Fprintf(os.Stderr, "error on creating user: %s\n", err)
+			return exitCommandError
+		}
+		fmt.Printf("created user %d %s\n", u.ID, u.Email)
+	case "reset-password":
+		u, err := db.Users().GetByEmail(*email)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error on finding user %s: %s\n", *email, err)
+			return exitCommandError
+		}
+		if err := u.SetPassword(password); err != nil {
+			fmt.Fprintf(os.Stderr, "error on setting password: %s\n", err)
+			return exitCommandError
+		}
+		if err := db.Users().Update(u); err != nil {
+			fmt.Fprintf(os.Stderr, "error on updating user: %s\n", err)
+			return exitCommandError
+		}
+		// Revoking sessions does not need the cookie secret
+		if err := base.NewSessionStore(db, nil, 0).RevokeUser(u.ID); err != nil {
+			fmt.Fprintf(os.Stderr, "error on revoking sessions: %s\n", err)
+			return exitCommandError
+		}
+		fmt.Printf("reset password of user %d %s\n", u.ID, u.Email)
+	}
+	return exitOK
+}
+
+// readPassword reads the password from stdin, so it does not show in the
+// process list or the shell history. On a terminal it prompts for it
+// without echo, otherwise it reads the first line.
+func readPassword() (string, error) {
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, "password: ")
+		b, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(b), err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,305 @@
+package base
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/boltdb/bolt"
+)
+
+// IndexKeyFunc return the index key of a record, or nil when the record is
+// not indexed
+type IndexKeyFunc[T any] func(v *T) []byte
+
+// index is a secondary index kept in a companion bucket.
+//
+// A unique index maps key to the record ID. A non-unique index stores
+// key followed by the 8-byte record ID with an empty value, so records
+// sharing a key are found with a prefix scan.
+type index[T any] struct {
+	name   string
+	bucket []byte
+	unique bool
+	key    IndexKeyFunc[T]
+}
+
+// entry return the companion bucket key and value of v
+func (ix *index[T]) entry(k []byte, id uint64) ([]byte, []byte) {
+	if ix.unique {
+		return k, itob(id)
+	}
+	return append(append([]byte(nil), k...), itob(id)...), []byte{}
+}
+
+// IndexProblem describes a difference between an index and its primary bucket
+type IndexProblem struct {
+	Bucket string `json:"bucket"`
+	Index  string `json:"index"`
+	Key    string `json:"key"`
+	ID     uint64 `json:"id"`
+	Reason string `json:"reason"`
+}
+
+func (p IndexProblem) String() string {
+	return fmt.Sprintf("%s.%s %q -> %d: %s", p.Bucket, p.Index, p.Key, p.ID, p.Reason)
+}
+
+// Indexer is implemented by stores that maintain secondary indexes
+type Indexer interface {
+	// Bucket return the primary bucket name
+	Bucket() []byte
+	// VerifyIndexes compares the indexes with the primary bucket
+	VerifyIndexes() ([]IndexProblem, error)
+	// RebuildIndexes recreates the indexes from the primary bucket
+	RebuildIndexes() error
+}
+
+var (
+	indexersMu sync.Mutex
+	indexers   = map[string]Indexer{}
+)
+
+// RegisterIndexer makes an indexer available to the index tools.
+// Repositories register themselves when their first index is added.
+func RegisterIndexer(ix Indexer) {
+	indexersMu.Lock()
+	defer indexersMu.Unlock()
+	indexers[string(ix.Bucket())] = ix
+}
+
+// Indexers return the registered indexers
+func Indexers() []Indexer {
+	indexersMu.Lock()
+	defer indexersMu.Unlock()
+	list := make([]Indexer, 0, len(indexers))
+	for _, ix := range indexers {
+		list = append(list, ix)
+	}
+	return list
+}
+
+// AddIndex declares a secondary index on the repository. The index is kept
+// in the bucket "<bucket>_by_<name>" and updated in the same transaction
+// as the records. Put fails with ErrDuplicateRow when a unique key is
+// already used by another record.
+func (r *Repository[T, P]) AddIndex(name string, unique bool, key IndexKeyFunc[T]) *Repository[T, P] {
+	r.addIndex(name, unique, key)
+	RegisterIndexer(r)
+	return r
+}
+
+// addIndex is AddIndex without registering the repository, for stores
+// that are indexers themselves
+func (r *Repository[T, P]) addIndex(name string, unique bool, key IndexKeyFunc[T]) {
+	r.indexes = append(r.indexes, &index[T]{
+		name:   name,
+		bucket: []byte(string(r.bucket) + "_by_" + name),
+		unique: unique,
+		key:    key,
+	})
+}
+
+// GetBy return the record with key in a unique index
+func (r *Repository[T, P]) GetBy(name string, key []byte) (P, error) {
+	var v P
+	err := r.db.View(func(tx *bolt.Tx) error {
+		ids, err := r.lookup(tx, name, key, 1)
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return ErrNoRows
+		}
+		v, err = r.GetTx(tx, ids[0])
+		return err
+	})
+	return v, err
+}
+
+// FindBy return every record with key in an index, ordered by ID
+func (r *Repository[T, P]) FindBy(name string, key []byte) ([]P, error) {
+	var list []P
+	err := r.db.View(func(tx *bolt.Tx) error {
+		ids, err := r.lookup(tx, name, key, 0)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			v, err := r.GetTx(tx, id)
+			if err != nil {
+				return err
+			}
+			list = append(list, v)
+		}
+		return nil
+	})
+	return list, err
+}
+
+// VerifyIndexes reports index entries that are missing, stale or point to
+// missing records
+func (r *Repository[T, P]) VerifyIndexes() ([]IndexProblem, error) {
+	var problems []IndexProblem
+	err := r.db.View(func(tx *bolt.Tx) error {
+		for _, ix := range r.indexes {
+			want := map[string]uint64{}
+			err := r.ForEachTx(tx, func(v P) error {
+				if k := ix.key((*T)(v)); k != nil {
+					ek, _ := ix.entry(k, v.GetID())
+					want[string(ek)] = v.GetID()
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			b := tx.Bucket(ix.bucket)
+			if b != nil {
+				err = b.ForEach(func(k, val []byte) error {
+					key, id := ix.decode(k, val)
+					wantID, ok := want[string(k)]
+					switch {
+					case !ok:
+						reason := "stale entry"
+						if _, err := r.GetTx(tx, id); err == ErrNoRows {
+							reason = "record does not exist"
+						}
+						problems = append(problems, r.problem(ix, key, id, reason))
+					case wantID != id:
+						problems = append(problems, r.problem(ix, key, id, fmt.Sprintf("points to wrong record, want %d", wantID)))
+					}
+					delete(want, string(k))
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+			for k, id := range want {
+				key, _ := ix.decode([]byte(k), itob(id))
+				problems = append(problems, r.problem(ix, key, id, "missing entry"))
+			}
+		}
+		return nil
+	})
+	return problems, err
+}
+
+// RebuildIndexes drops and recreates every index from the primary bucket.
+// It fails with ErrDuplicateRow, leaving the indexes unchanged, when
+// records violate a unique index.
+func (r *Repository[T, P]) RebuildIndexes() error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		for _, ix := range r.indexes {
+			if tx.Bucket(ix.bucket) != nil {
+				if err := tx.DeleteBucket(ix.bucket); err != nil {
+					return err
+				}
+			}
+		}
+		return r.ForEachTx(tx, func(v P) error {
+			return r.putIndexes(tx, nil, v)
+		})
+	})
+}
+
+// putIndexes replaces the index entries of old with those of v.
+// old is nil for a new record and v is nil for a deleted one.
+func (r *Repository[T, P]) putIndexes(tx *bolt.Tx, old, v P) error {
+	for _, ix := range r.indexes {
+		b, err := tx.CreateBucketIfNotExists(ix.bucket)
+		if err != nil {
+			return err
+		}
+		var oldKey, newKey []byte
+		if old != nil {
+			oldKey = ix.key((*T)(old))
+		}
+		if v != nil {
+			newKey = ix.key((*T)(v))
+		}
+		if old != nil && v != nil && bytes.Equal(oldKey, newKey) {
+			continue
+		}
+		if oldKey != nil {
+			k, _ := ix.entry(oldKey, old.GetID())
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		if newKey == nil {
+			continue
+		}
+		if ix.unique {
+			if cur := b.Get(newKey); cur != nil && btoi(cur) != v.GetID() {
+				return ErrDuplicateRow
+			}
+		}
+		k, val := ix.entry(newKey, v.GetID())
+		if err := b.Put(k, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookup return the IDs stored under key in the named index. A limit of
+// 0 return every ID.
+func (r *Repository[T, P]) lookup(tx *bolt.Tx, name string, key []byte, limit int) ([]uint64, error) {
+	ix := r.index(name)
+	if ix == nil {
+		return nil, fmt.Errorf("db: no index %q on %s", name, r.bucket)
+	}
+	b := tx.Bucket(ix.bucket)
+	if b == nil {
+		return nil, nil
+	}
+	if ix.unique {
+		v := b.Get(key)
+		if v == nil {
+			return nil, nil
+		}
+		return []uint64{btoi(v)}, nil
+	}
+	var ids []uint64
+	c := b.Cursor()
+	for k, _ := c.Seek(key); k != nil && bytes.HasPrefix(k, key); k, _ = c.Next() {
+		if len(k) != len(key)+8 {
+			continue
+		}
+		ids = append(ids, btoi(k[len(key):]))
+		if limit > 0 && len(ids) == limit {
+			break
+		}
+	}
+	return ids, nil
+}
+
+// index return the named index or nil
+func (r *Repository[T, P]) index(name string) *index[T] {
+	for _, ix := range r.indexes {
+		if ix.name == name {
+			return ix
+		}
+	}
+	return nil
+}
+
+// decode splits a companion bucket entry into index key and record ID
+func (ix *index[T]) decode(k, v []byte) ([]byte, uint64) {
+	if ix.unique {
+		if len(v) != 8 {
+			return k, 0
+		}
+		return k, btoi(v)
+	}
+	if len(k) < 8 {
+		return k, 0
+	}
+	return k[:len(k)-8], btoi(k[len(k)-8:])
+}
+
+func (r *Repository[T, P]) problem(ix *index[T], key []byte, id uint64, reason string) IndexProblem {
+	return IndexProblem{Bucket: string(r.bucket), Index: ix.name, Key: string(key), ID: id, Reason: reason}
+}
@@ -0,0 +1,172 @@
+package base
+
+import (
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+// indexedNotes return a notes repository with a unique index on the text
+// and a non-unique index on the owner
+func indexedNotes(db *DB) *Repository[note, *note] {
+	return NewRepository[note](db, "notes").
+		AddIndex("text", true, func(n *note) []byte { return []byte(n.Text) }).
+		AddIndex("owner", false, func(n *note) []byte {
+			if n.Owner == "" {
+				return nil
+			}
+			return []byte(n.Owner)
+		})
+}
+
+func putNotes(t *testing.T, r *Repository[note, *note], notes ...*note) {
+	t.Helper()
+	for _, n := range notes {
+		if err := r.Put(n); err != nil {
+			t.Fatalf("put %+v: %s", n, err)
+		}
+	}
+}
+
+func TestIndexLookup(t *testing.T) {
+	notes := indexedNotes(newTestDB(t))
+	putNotes(t, notes, &note{Text: "a", Owner: "ann"}, &note{Text: "b", Owner: "bob"}, &note{Text: "c", Owner: "ann"}, &note{Text: "d"})
+
+	n, err := notes.GetBy("text", []byte("b"))
+	if err != nil || n.ID != 2 {
+		t.Fatalf("get by text = %+v, %v", n, err)
+	}
+	if _, err := notes.GetBy("text", []byte("z")); err != ErrNoRows {
+		t.Errorf("get by missing text = %v, want %v", err, ErrNoRows)
+	}
+
+	list, err := notes.FindBy("owner", []byte("ann"))
+	if err != nil || len(list) != 2 || list[0].ID != 1 || list[1].ID != 3 {
+		t.Fatalf("find by owner = %+v, %v", list, err)
+	}
+	// "an" is a prefix of "ann" but not a key of its own
+	if list, _ := notes.FindBy("owner", []byte("an")); len(list) != 0 {
+		t.Errorf("find by key prefix = %+v", list)
+	}
+	if _, err := notes.FindBy("nope", nil); err == nil {
+		t.Error("find by unknown index did not fail")
+	}
+}
+
+func TestIndexUnique(t *testing.T) {
+	notes := indexedNotes(newTestDB(t))
+	putNotes(t, notes, &note{Text: "a"}, &note{Text: "b"})
+
+	if err := notes.Put(&note{Text: "a"}); err != ErrDuplicateRow {
+		t.Errorf("put duplicate = %v, want %v", err, ErrDuplicateRow)
+	}
+	if err := notes.Put(&note{ID: 2, Text: "a"}); err != ErrDuplicateRow {
+		t.Errorf("update to duplicate = %v, want %v", err, ErrDuplicateRow)
+	}
+	// Saving a record with its own key is not a duplicate
+	if err := notes.Put(&note{ID: 1, Text: "a", Owner: "ann"}); err != nil {
+		t.Errorf("put unchanged key: %s", err)
+	}
+}
+
+func TestIndexFollowsUpdateAndDelete(t *testing.T) {
+	notes := indexedNotes(newTestDB(t))
+	n := &note{Text: "a", Owner: "ann"}
+	putNotes(t, notes, n)
+
+	n.Text, n.Owner = "b", "bob"
+	putNotes(t, notes, n)
+	if _, err := notes.GetBy("text", []byte("a")); err != ErrNoRows {
+		t.Errorf("get by old text = %v, want %v", err, ErrNoRows)
+	}
+	if list, _ := notes.FindBy("owner", []byte("ann")); len(list) != 0 {
+		t.Errorf("find by old owner = %+v", list)
+	}
+	if got, err := notes.GetBy("text", []byte("b")); err != nil || got.ID != n.ID {
+		t.Errorf("get by new text = %+v, %v", got, err)
+	}
+
+	if err := notes.Delete(n.ID); err != nil {
+		t.Fatalf("delete: %s", err)
+	}
+	problems, err := notes.VerifyIndexes()
+	if err != nil || len(problems) != 0 {
+		t.Errorf("verify after delete = %v, %v", problems, err)
+	}
+}
+
+func TestIndexVerifyAndRebuild(t *testing.T) {
+	db := newTestDB(t)
+	notes := indexedNotes(db)
+	putNotes(t, notes, &note{Text: "a", Owner: "ann"}, &note{Text: "b", Owner: "bob"})
+
+	// Drift the indexes: drop an entry and add one for no record
+	err := db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket([]byte("notes_by_text")).Delete([]byte("a")); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte("notes_by_owner")).Put(append([]byte("cat"), itob(9)...), []byte{})
+	})
+	if err != nil {
+		t.Fatalf("drift: %s", err)
+	}
+
+	problems, err := notes.VerifyIndexes()
+	if err != nil {
+		t.Fatalf("verify: %s", err)
+	}
+	reasons := map[string]string{}
+	for _, p := range problems {
+		reasons[p.Index+" "+p.Key] = p.Reason
+	}
+	if len(problems) != 2 || reasons["text a"] != "missing entry" || reasons["owner cat"] != "record does not exist" {
+		t.Errorf("problems = %v", problems)
+	}
+
+	if err := notes.RebuildIndexes(); err != nil {
+		t.Fatalf("rebuild: %s", err)
+	}
+	if problems, err := notes.VerifyIndexes(); err != nil || len(problems) != 0 {
+		t.Errorf("verify after rebuild = %v, %v", problems, err)
+	}
+}
+
+func TestIndexRebuildRefusesDuplicates(t *testing.T) {
+	db := newTestDB(t)
+	notes := indexedNotes(db)
+	putNotes(t, notes, &note{Text: "a"})
+	// A second "a" written behind the index
+	err := db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("notes")).Put(itob(2), []byte(`{"id":2,"text":"a"}`))
+	})
+	if err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	if err := notes.RebuildIndexes(); err != ErrDuplicateRow {
+		t.Errorf("rebuild = %v, want %v", err, ErrDuplicateRow)
+	}
+	if got, err := notes.GetBy("text", []byte("a")); err != nil || got.ID != 1 {
+		t.Errorf("index after failed rebuild = %+v, %v", got, err)
+	}
+}
+
+func TestUserStoreIndexes(t *testing.T) {
+	db := newTestDB(t)
+	s := db.Users()
+	createUser(t, s, "a@example.com")
+	err := db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(usersByEmailBucket).Delete([]byte("a@example.com"))
+	})
+	if err != nil {
+		t.Fatalf("drift: %s", err)
+	}
+	if problems, err := s.VerifyIndexes(); err != nil || len(problems) != 1 || problems[0].Index != "email" {
+		t.Errorf("verify = %v, %v", problems, err)
+	}
+	if err := s.RebuildIndexes(); err != nil {
+		t.Fatalf("rebuild: %s", err)
+	}
+	if _, err := s.GetByEmail("a@example.com"); err != nil {
+		t.Errorf("get by email after rebuild: %s", err)
+	}
+}
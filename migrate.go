@@ -0,0 +1,199 @@
+package base
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// metaBucket for database metadata
+var metaBucket = []byte("meta")
+
+// migrationsBucket is nested in metaBucket and records applied migrations
+var migrationsBucket = []byte("migrations")
+
+// ErrMigrationDowngrade for migrating to a version older than the applied one
+var ErrMigrationDowngrade = errors.New("db: cannot migrate down, migrations only run forward")
+
+// ErrUnknownMigration for migrating to a version that is not registered
+var ErrUnknownMigration = errors.New("db: unknown migration version")
+
+// errDryRun rolls back the migration transaction in dry-run mode
+var errDryRun = errors.New("db: dry run")
+
+// MigrationFunc changes stored data inside a read-write transaction
+type MigrationFunc func(tx *bolt.Tx) error
+
+// Migration is a versioned change to the stored data
+type Migration struct {
+	Version int
+	Name    string
+	Up      MigrationFunc
+}
+
+// MigrationStatus reports whether a migration has been applied
+type MigrationStatus struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	Applied   bool      `json:"applied"`
+	AppliedAt time.Time `json:"appliedAt,omitempty"`
+}
+
+// appliedMigration is the record stored for an applied migration
+type appliedMigration struct {
+	Name      string    `json:"name"`
+	AppliedAt time.Time `json:"appliedAt"`
+}
+
+// migrations holds the registered migrations ordered by version
+var migrations []Migration
+
+// RegisterMigration adds a migration. It is meant to be called from init
+// functions and panics when the version is not positive or already taken.
+func RegisterMigration(version int, name string, up MigrationFunc) {
+	if version <= 0 {
+		panic(fmt.Sprintf("db: migration %q has invalid version %d", name, version))
+	}
+	for _, m := range migrations {
+		if m.Version == version {
+			panic(fmt.Sprintf("db: migration version %d registered twice (%q and %q)", version, m.Name, name))
+		}
+	}
+	migrations = append(migrations, Migration{Version: version, Name: name, Up: up})
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+}
+
+// Migrations return the registered migrations ordered by version
+func Migrations() []Migration {
+	return append([]Migration(nil), migrations...)
+}
+
+// MigrationStatus return the status of every registered migration
+func (db *DB) MigrationStatus() ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := db.View(func(tx *bolt.Tx) error {
+		b := migrationsBucketOf(tx)
+		for _, m := range migrations {
+			st := MigrationStatus{Version: m.Version, Name: m.Name}
+			if b != nil {
+				if v := b.Get(itob(uint64(m.Version))); v != nil {
+					var am appliedMigration
+					if err := json.Unmarshal(v, &am); err != nil {
+						return fmt.Errorf("db: error decoding migration %d: %s", m.Version, err)
+					}
+					st.Applied = true
+					st.AppliedAt = am.AppliedAt
+				}
+			}
+			statuses = append(statuses, st)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// MigrationVersion return the highest applied migration version, or 0
+func (db *DB) MigrationVersion() (int, error) {
+	version := 0
+	err := db.View(func(tx *bolt.Tx) error {
+		b := migrationsBucketOf(tx)
+		if b == nil {
+			return nil
+		}
+		if k, _ := b.Cursor().Last(); k != nil {
+			version = int(btoi(k))
+		}
+		return nil
+	})
+	return version, err
+}
+
+// MigrateUp applies every pending migration
+func (db *DB) MigrateUp(dryRun bool) ([]Migration, error) {
+	if len(migrations) == 0 {
+		return nil, nil
+	}
+	return db.MigrateTo(migrations[len(migrations)-1].Version, dryRun)
+}
+
+// MigrateTo applies pending migrations up to and including version.
+// Every pending migration runs in a single transaction together with the
+// records of them being applied, so either all of them are applied or
+// none is. In dry-run mode the transaction is rolled back at the end.
+// It return the migrations that were applied.
+func (db *DB) MigrateTo(version int, dryRun bool) ([]Migration, error) {
+	if version != 0 && !migrationExists(version) {
+		return nil, ErrUnknownMigration
+	}
+	current, err := db.MigrationVersion()
+	if err != nil {
+		return nil, err
+	}
+	if version < current {
+		return nil, ErrMigrationDowngrade
+	}
+
+	var applied []Migration
+	err = db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+		b, err := meta.CreateBucketIfNotExists(migrationsBucket)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if m.Version > version {
+				break
+			}
+			if b.Get(itob(uint64(m.Version))) != nil {
+				continue
+			}
+			if err := m.Up(tx); err != nil {
+				return fmt.Errorf("db: migration %d %q failed: %s", m.Version, m.Name, err)
+			}
+			buf, err := json.Marshal(appliedMigration{Name: m.Name, AppliedAt: TimeNow()})
+			if err != nil {
+				return err
+			}
+			if err := b.Put(itob(uint64(m.Version)), buf); err != nil {
+				return err
+			}
+			applied = append(applied, m)
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && err != errDryRun {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// migrationsBucketOf return the applied migrations bucket or nil
+func migrationsBucketOf(tx *bolt.Tx) *bolt.Bucket {
+	meta := tx.Bucket(metaBucket)
+	if meta == nil {
+		return nil
+	}
+	return meta.Bucket(migrationsBucket)
+}
+
+// migrationExists reports whether version is registered
+func migrationExists(version int) bool {
+	for _, m := range migrations {
+		if m.Version == version {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package base
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+// withMigrations replaces the registered migrations for the test
+func withMigrations(t *testing.T, ms ...Migration) {
+	t.Helper()
+	saved := migrations
+	migrations = nil
+	t.Cleanup(func() { migrations = saved })
+	for _, m := range ms {
+		RegisterMigration(m.Version, m.Name, m.Up)
+	}
+}
+
+// bucketChain creates bucket x and then fills it, so the second migration
+// only works after the first
+var bucketChain = []Migration{
+	{Version: 1, Name: "create x", Up: func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucket([]byte("x"))
+		return err
+	}},
+	{Version: 2, Name: "fill x", Up: func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("x"))
+		if b == nil {
+			return errors.New("bucket x missing")
+		}
+		return b.Put([]byte("k"), []byte("v"))
+	}},
+}
+
+func TestMigrateUp(t *testing.T) {
+	withMigrations(t, bucketChain...)
+	db := newTestDB(t)
+
+	applied, err := db.MigrateUp(false)
+	if err != nil || len(applied) != 2 {
+		t.Fatalf("migrate up = %d applied, %v", len(applied), err)
+	}
+	if v, err := db.MigrationVersion(); err != nil || v != 2 {
+		t.Errorf("version = %d, %v, want 2", v, err)
+	}
+	statuses, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatalf("status: %s", err)
+	}
+	for _, st := range statuses {
+		if !st.Applied || st.AppliedAt.IsZero() {
+			t.Errorf("status = %+v, want applied", st)
+		}
+	}
+
+	applied, err = db.MigrateUp(false)
+	if err != nil || len(applied) != 0 {
+		t.Errorf("second migrate up = %d applied, %v", len(applied), err)
+	}
+}
+
+func TestMigrateDryRun(t *testing.T) {
+	withMigrations(t, bucketChain...)
+	db := newTestDB(t)
+
+	applied, err := db.MigrateUp(true)
+	if err != nil || len(applied) != 2 {
+		t.Fatalf("dry run = %d applied, %v", len(applied), err)
+	}
+	if v, err := db.MigrationVersion(); err != nil || v != 0 {
+		t.Errorf("version after dry run = %d, %v, want 0", v, err)
+	}
+	db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte("x")) != nil {
+			t.Error("dry run left bucket x")
+		}
+		return nil
+	})
+}
+
+func TestMigrateTo(t *testing.T) {
+	withMigrations(t, bucketChain...)
+	db := newTestDB(t)
+
+	if _, err := db.MigrateTo(3, false); err != ErrUnknownMigration {
+		t.Errorf("migrate to 3 = %v, want %v", err, ErrUnknownMigration)
+	}
+	applied, err := db.MigrateTo(1, false)
+	if err != nil || len(applied) != 1 || applied[0].Version != 1 {
+		t.Fatalf("migrate to 1 = %v, %v", applied, err)
+	}
+	if _, err := db.MigrateTo(0, false); err != ErrMigrationDowngrade {
+		t.Errorf("migrate to 0 = %v, want %v", err, ErrMigrationDowngrade)
+	}
+}
+
+func TestMigrateFailureRollsBack(t *testing.T) {
+	withMigrations(t, bucketChain[0], Migration{Version: 2, Name: "fail", Up: func(tx *bolt.Tx) error {
+		return errors.New("boom")
+	}})
+	db := newTestDB(t)
+
+	if _, err := db.MigrateUp(false); err == nil {
+		t.Fatal("migrate up did not fail")
+	}
+	if v, err := db.MigrationVersion(); err != nil || v != 0 {
+		t.Errorf("version after failure = %d, %v, want 0", v, err)
+	}
+}
+
+func TestRegisterMigrationPanics(t *testing.T) {
+	withMigrations(t, bucketChain[0])
+	for _, version := range []int{0, 1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("register version %d did not panic", version)
+				}
+			}()
+			RegisterMigration(version, "bad", bucketChain[0].Up)
+		}()
+	}
+}
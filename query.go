@@ -0,0 +1,242 @@
+package base
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+
+	"github.com/boltdb/bolt"
+)
+
+// ErrInvalidCursor for a continuation token that cannot be decoded or was
+// taken from another query
+var ErrInvalidCursor = errors.New("db: invalid cursor")
+
+// cursor directions stored in the first byte of a continuation token
+const (
+	cursorNext = 'n'
+	cursorPrev = 'p'
+)
+
+// cursorScopeLen is the length of the query digest following the
+// direction in a continuation token
+const cursorScopeLen = 8
+
+// Query selects a page of keys from a bucket.
+//
+// Keys are restricted to those starting with Prefix and in [Start, End).
+// Keys are returned in ascending order, or descending order when Reverse is
+// set. Limit caps the number of keys returned; zero means no limit. Cursor
+// is a continuation token taken from a previous PageInfo.
+type Query struct {
+	Prefix  []byte
+	Start   []byte
+	End     []byte
+	Reverse bool
+	Limit   int
+	Cursor  string
+}
+
+// PageInfo carries the continuation tokens of a page. Next and Prev are
+// empty when there is no page in that direction.
+type PageInfo struct {
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+// Uint64Key return the bucket key of an auto-increment ID, for use in Query
+// bounds
+func Uint64Key(id uint64) []byte {
+	return itob(id)
+}
+
+// KeyUint64 decodes an auto-increment ID key, the inverse of Uint64Key.
+// k must be 8 bytes long.
+func KeyUint64(k []byte) uint64 {
+	return btoi(k)
+}
+
+// Scan calls fn for the keys of bucket selected by q, in query order
+func (db *DB) Scan(bucket []byte, q Query, fn func(k, v []byte) error) (*PageInfo, error) {
+	var page *PageInfo
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		page, err = ScanTx(tx, bucket, q, fn)
+		return err
+	})
+	return page, err
+}
+
+// ScanTx is Scan inside an existing transaction
+func ScanTx(tx *bolt.Tx, bucket []byte, q Query, fn func(k, v []byte) error) (*PageInfo, error) {
+	page := &PageInfo{}
+	b := tx.Bucket(bucket)
+	if b == nil {
+		return page, nil
+	}
+
+	lo, hi := q.Start, q.End
+	if q.Prefix != nil {
+		if lo == nil || bytes.Compare(q.Prefix, lo) > 0 {
+			lo = q.Prefix
+		}
+		if end := prefixEnd(q.Prefix); end != nil && (hi == nil || bytes.Compare(end, hi) < 0) {
+			hi = end
+		}
+	}
+	inRange := func(k []byte) bool {
+		return k != nil &&
+			(lo == nil || bytes.Compare(k, lo) >= 0) &&
+			(hi == nil || bytes.Compare(k, hi) < 0) &&
+			bytes.HasPrefix(k, q.Prefix)
+	}
+
+	dir := byte(cursorNext)
+	var from []byte
+	scope := queryScope(bucket, q)
+	if q.Cursor != "" {
+		var err error
+		dir, from, err = decodeCursor(q.Cursor, scope)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// A prev cursor walks against the query order and flips the page after
+	descending := q.Reverse != (dir == cursorPrev)
+
+	c := b.Cursor()
+	var k, v []byte
+	switch {
+	case !descending && from != nil:
+		k, v = c.Seek(from)
+		if bytes.Equal(k, from) {
+			k, v = c.Next()
+		}
+	case !descending && lo != nil:
+		k, v = c.Seek(lo)
+	case !descending:
+		k, v = c.First()
+	default:
+		// Descending starts at the last key strictly before from or hi
+		start := from
+		if start == nil {
+			start = hi
+		}
+		if start == nil {
+			k, v = c.Last()
+		} else if k, v = c.Seek(start); k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+	}
+	step := c.Next
+	if descending {
+		step = c.Prev
+	}
+
+	type kv struct{ k, v []byte }
+	var items []kv
+	more := false
+	for ; inRange(k); k, v = step() {
+		if q.Limit > 0 && len(items) == q.Limit {
+			more = true
+			break
+		}
+		items = append(items, kv{k, v})
+	}
+
+	if dir == cursorPrev {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+	if len(items) > 0 {
+		first, last := items[0].k, items[len(items)-1].k
+		if more || dir == cursorPrev {
+			page.Next = encodeCursor(cursorNext, scope, last)
+		}
+		if (more && dir == cursorPrev) || (from != nil && dir == cursorNext) {
+			page.Prev = encodeCursor(cursorPrev, scope, first)
+		}
+	}
+
+	for _, it := range items {
+		if err := fn(it.k, it.v); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+// Query return a page of records selected by q
+func (r *Repository[T, P]) Query(q Query) ([]P, *PageInfo, error) {
+	var list []P
+	page, err := r.db.Scan(r.bucket, q, func(k, buf []byte) error {
+		v, err := r.decode(buf)
+		if err != nil {
+			return err
+		}
+		list = append(list, v)
+		return nil
+	})
+	return list, page, err
+}
+
+// Query return a page of users selected by q
+func (s *UserStore) Query(q Query) ([]*User, *PageInfo, error) {
+	records, page, err := s.repo.Query(q)
+	return users(records), page, err
+}
+
+// prefixEnd return the first key after every key starting with prefix,
+// or nil when there is none
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte(nil), prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// queryScope return a digest of the bucket and the query fields that
+// select and order keys. Cursors carry it so a cursor is only valid for
+// the listing it was taken from.
+func queryScope(bucket []byte, q Query) []byte {
+	h := sha256.New()
+	for _, f := range [][]byte{bucket, q.Prefix, q.Start, q.End} {
+		var n [4]byte
+		binary.BigEndian.PutUint32(n[:], uint32(len(f)))
+		h.Write(n[:])
+		h.Write(f)
+	}
+	if q.Reverse {
+		h.Write([]byte{1})
+	} else {
+		h.Write([]byte{0})
+	}
+	return h.Sum(nil)[:cursorScopeLen]
+}
+
+// encodeCursor return an opaque continuation token
+func encodeCursor(dir byte, scope, key []byte) string {
+	b := append([]byte{dir}, scope...)
+	return base64.RawURLEncoding.EncodeToString(append(b, key...))
+}
+
+// decodeCursor parses a continuation token taken from the query of scope
+func decodeCursor(s string, scope []byte) (byte, []byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) < 2+cursorScopeLen || (b[0] != cursorNext && b[0] != cursorPrev) {
+		return 0, nil, ErrInvalidCursor
+	}
+	if !bytes.Equal(b[1:1+cursorScopeLen], scope) {
+		return 0, nil, ErrInvalidCursor
+	}
+	return b[0], b[1+cursorScopeLen:], nil
+}
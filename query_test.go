@@ -0,0 +1,176 @@
+package base
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+// fillBucket writes the keys to bucket with their key as value
+func fillBucket(t *testing.T, db *DB, bucket string, keys ...string) {
+	t.Helper()
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := b.Put([]byte(k), []byte(k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("fill %s: %s", bucket, err)
+	}
+}
+
+// scanKeys return the keys selected by q and the page info
+func scanKeys(t *testing.T, db *DB, bucket string, q Query) ([]string, *PageInfo) {
+	t.Helper()
+	var keys []string
+	page, err := db.Scan([]byte(bucket), q, func(k, v []byte) error {
+		keys = append(keys, string(k))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scan %+v: %s", q, err)
+	}
+	return keys, page
+}
+
+func TestScanSelection(t *testing.T) {
+	db := newTestDB(t)
+	fillBucket(t, db, "x", "a1", "a2", "a3", "b1", "b2", "c1")
+
+	tests := []struct {
+		q    Query
+		want string
+	}{
+		{Query{}, "[a1 a2 a3 b1 b2 c1]"},
+		{Query{Prefix: []byte("b")}, "[b1 b2]"},
+		{Query{Start: []byte("a2"), End: []byte("b2")}, "[a2 a3 b1]"},
+		{Query{Prefix: []byte("a"), Start: []byte("a2")}, "[a2 a3]"},
+		{Query{Reverse: true, Limit: 2}, "[c1 b2]"},
+		{Query{Prefix: []byte("a"), Reverse: true}, "[a3 a2 a1]"},
+		{Query{Prefix: []byte("z")}, "[]"},
+	}
+	for _, tt := range tests {
+		keys, _ := scanKeys(t, db, "x", tt.q)
+		if got := fmt.Sprint(keys); got != tt.want && !(keys == nil && tt.want == "[]") {
+			t.Errorf("scan %+v = %s, want %s", tt.q, got, tt.want)
+		}
+	}
+
+	keys, page := scanKeys(t, db, "missing", Query{})
+	if len(keys) != 0 || page.Next != "" || page.Prev != "" {
+		t.Errorf("scan of missing bucket = %v, %+v", keys, page)
+	}
+}
+
+func TestScanCursors(t *testing.T) {
+	db := newTestDB(t)
+	fillBucket(t, db, "x", "1", "2", "3", "4", "5")
+
+	for _, reverse := range []bool{false, true} {
+		want := []string{"[1 2]", "[3 4]", "[5]"}
+		if reverse {
+			want = []string{"[5 4]", "[3 2]", "[1]"}
+		}
+		q := Query{Limit: 2, Reverse: reverse}
+		var pages []*PageInfo
+		for i, w := range want {
+			keys, page := scanKeys(t, db, "x", q)
+			if got := fmt.Sprint(keys); got != w {
+				t.Fatalf("reverse=%t page %d = %s, want %s", reverse, i, got, w)
+			}
+			if (page.Prev != "") != (i > 0) || (page.Next != "") != (i < len(want)-1) {
+				t.Fatalf("reverse=%t page %d links = %+v", reverse, i, page)
+			}
+			pages = append(pages, page)
+			q.Cursor = page.Next
+		}
+
+		// Walking back from the last page returns the middle page
+		q.Cursor = pages[2].Prev
+		keys, page := scanKeys(t, db, "x", q)
+		if got := fmt.Sprint(keys); got != want[1] {
+			t.Errorf("reverse=%t prev page = %s, want %s", reverse, got, want[1])
+		}
+		if page.Next == "" || page.Prev == "" {
+			t.Errorf("reverse=%t prev page links = %+v", reverse, page)
+		}
+	}
+}
+
+func TestScanInvalidCursor(t *testing.T) {
+	db := newTestDB(t)
+	fillBucket(t, db, "x", "a1", "a2", "b1", "b2")
+	fillBucket(t, db, "y", "a1", "a2", "b1", "b2")
+	_, page := scanKeys(t, db, "x", Query{Prefix: []byte("a"), Limit: 1})
+
+	tests := []struct {
+		bucket string
+		q      Query
+	}{
+		{"x", Query{Cursor: "!!!"}},
+		{"x", Query{Cursor: "bg"}},
+		// A cursor is bound to the bucket, selection and order of its query
+		{"y", Query{Prefix: []byte("a"), Limit: 1, Cursor: page.Next}},
+		{"x", Query{Prefix: []byte("b"), Limit: 1, Cursor: page.Next}},
+		{"x", Query{Limit: 1, Cursor: page.Next}},
+		{"x", Query{Prefix: []byte("a"), Limit: 1, Reverse: true, Cursor: page.Next}},
+	}
+	for _, tt := range tests {
+		_, err := db.Scan([]byte(tt.bucket), tt.q, func(k, v []byte) error { return nil })
+		if err != ErrInvalidCursor {
+			t.Errorf("scan %s %+v = %v, want %v", tt.bucket, tt.q, err, ErrInvalidCursor)
+		}
+	}
+
+	// The limit may change between pages
+	keys, _ := scanKeys(t, db, "x", Query{Prefix: []byte("a"), Limit: 5, Cursor: page.Next})
+	if fmt.Sprint(keys) != "[a2]" {
+		t.Errorf("next page with another limit = %v", keys)
+	}
+}
+
+func TestRepositoryQuery(t *testing.T) {
+	notes := NewRepository[note](newTestDB(t), "notes")
+	for i := 0; i < 5; i++ {
+		if err := notes.Put(&note{Text: fmt.Sprint(i)}); err != nil {
+			t.Fatalf("put: %s", err)
+		}
+	}
+	list, page, err := notes.Query(Query{Start: Uint64Key(2), Limit: 2})
+	if err != nil {
+		t.Fatalf("query: %s", err)
+	}
+	if len(list) != 2 || list[0].ID != 2 || list[1].ID != 3 || page.Next == "" {
+		t.Errorf("query = %+v, %+v", list, page)
+	}
+}
+
+func TestUserStoreQuery(t *testing.T) {
+	s := newTestDB(t).Users()
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		createUser(t, s, email)
+	}
+	users, page, err := s.Query(Query{Reverse: true, Limit: 2})
+	if err != nil {
+		t.Fatalf("query: %s", err)
+	}
+	if len(users) != 2 || users[0].Email != "c@example.com" || users[0].PasswordHash == "" || page.Next == "" {
+		t.Errorf("query = %+v, %+v", users, page)
+	}
+}
+
+func TestUint64KeyRoundTrip(t *testing.T) {
+	for _, id := range []uint64{0, 1, 255, 256, 1<<63 + 5} {
+		if got := KeyUint64(Uint64Key(id)); got != id {
+			t.Errorf("KeyUint64(Uint64Key(%d)) = %d", id, got)
+		}
+	}
+}
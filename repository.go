@@ -0,0 +1,186 @@
+package base
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+// Entity is implemented by records stored in a Repository.
+// The ID is assigned from the bucket sequence when it is zero on Put.
+type Entity interface {
+	GetID() uint64
+	SetID(id uint64)
+}
+
+// EntityPtr constrains P to be a pointer to T implementing Entity
+type EntityPtr[T any] interface {
+	*T
+	Entity
+}
+
+// Repository stores records of type T as JSON in a bucket, keyed by ID.
+//
+// A new entity only needs a struct and a bucket name:
+//
+//	type Note struct {
+//		ID   uint64 `json:"id"`
+//		Text string `json:"text"`
+//	}
+//
+//	func (n *Note) GetID() uint64   { return n.ID }
+//	func (n *Note) SetID(id uint64) { n.ID = id }
+//
+//	notes := base.NewRepository[Note](db, "notes")
+type Repository[T any, P EntityPtr[T]] struct {
+	db      *DB
+	bucket  []byte
+	indexes []*index[T]
+}
+
+// NewRepository return a repository storing T in bucket
+func NewRepository[T any, P EntityPtr[T]](db *DB, bucket string) *Repository[T, P] {
+	return &Repository[T, P]{db: db, bucket: []byte(bucket)}
+}
+
+// Bucket return the name of the repository bucket
+func (r *Repository[T, P]) Bucket() []byte {
+	return r.bucket
+}
+
+// Get return the record with id
+func (r *Repository[T, P]) Get(id uint64) (P, error) {
+	var v P
+	err := r.db.View(func(tx *bolt.Tx) error {
+		var err error
+		v, err = r.GetTx(tx, id)
+		return err
+	})
+	return v, err
+}
+
+// Put inserts or replaces v and updates its index entries. A zero ID is
+// replaced with the next ID of the bucket sequence, an explicit ID moves
+// the sequence past it.
+func (r *Repository[T, P]) Put(v P) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return r.PutTx(tx, v)
+	})
+}
+
+// Delete removes the record with id
+func (r *Repository[T, P]) Delete(id uint64) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return r.DeleteTx(tx, id)
+	})
+}
+
+// List return all records ordered by ID
+func (r *Repository[T, P]) List() ([]P, error) {
+	var list []P
+	err := r.ForEach(func(v P) error {
+		list = append(list, v)
+		return nil
+	})
+	return list, err
+}
+
+// ForEach calls fn for every record in ID order. It stops at the first
+// error returned by fn.
+func (r *Repository[T, P]) ForEach(fn func(v P) error) error {
+	return r.db.View(func(tx *bolt.Tx) error {
+		return r.ForEachTx(tx, fn)
+	})
+}
+
+// GetTx is Get inside an existing transaction
+func (r *Repository[T, P]) GetTx(tx *bolt.Tx, id uint64) (P, error) {
+	b := tx.Bucket(r.bucket)
+	if b == nil {
+		return nil, ErrNoRows
+	}
+	buf := b.Get(itob(id))
+	if buf == nil {
+		return nil, ErrNoRows
+	}
+	return r.decode(buf)
+}
+
+// PutTx is Put inside an existing read-write transaction
+func (r *Repository[T, P]) PutTx(tx *bolt.Tx, v P) error {
+	b, err := tx.CreateBucketIfNotExists(r.bucket)
+	if err != nil {
+		return err
+	}
+	var old P
+	if v.GetID() == 0 {
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		// A record stored under this ID without going through the
+		// sequence must not be silently replaced
+		if b.Get(itob(id)) != nil {
+			return ErrDuplicateRow
+		}
+		v.SetID(id)
+	} else {
+		// Keep the sequence past explicit IDs so later auto IDs do not
+		// collide with them
+		if v.GetID() > b.Sequence() {
+			if err := b.SetSequence(v.GetID()); err != nil {
+				return err
+			}
+		}
+		if buf := b.Get(itob(v.GetID())); buf != nil && len(r.indexes) > 0 {
+			if old, err = r.decode(buf); err != nil {
+				return err
+			}
+		}
+	}
+	if err := r.putIndexes(tx, old, v); err != nil {
+		return err
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("db: error encoding %s: %s", r.bucket, err)
+	}
+	return b.Put(itob(v.GetID()), buf)
+}
+
+// DeleteTx is Delete inside an existing read-write transaction
+func (r *Repository[T, P]) DeleteTx(tx *bolt.Tx, id uint64) error {
+	old, err := r.GetTx(tx, id)
+	if err != nil {
+		return err
+	}
+	if err := r.putIndexes(tx, old, nil); err != nil {
+		return err
+	}
+	return tx.Bucket(r.bucket).Delete(itob(id))
+}
+
+// ForEachTx is ForEach inside an existing transaction
+func (r *Repository[T, P]) ForEachTx(tx *bolt.Tx, fn func(v P) error) error {
+	b := tx.Bucket(r.bucket)
+	if b == nil {
+		return nil
+	}
+	return b.ForEach(func(k, buf []byte) error {
+		v, err := r.decode(buf)
+		if err != nil {
+			return err
+		}
+		return fn(v)
+	})
+}
+
+// decode decode a stored record
+func (r *Repository[T, P]) decode(buf []byte) (P, error) {
+	v := P(new(T))
+	if err := json.Unmarshal(buf, v); err != nil {
+		return nil, fmt.Errorf("db: error decoding %s: %s", r.bucket, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,122 @@
+package base
+
+import (
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+// note is the entity stored by the repository tests
+type note struct {
+	ID    uint64 `json:"id"`
+	Text  string `json:"text"`
+	Owner string `json:"owner"`
+}
+
+func (n *note) GetID() uint64   { return n.ID }
+func (n *note) SetID(id uint64) { n.ID = id }
+
+func TestRepositoryPutGetDelete(t *testing.T) {
+	notes := NewRepository[note](newTestDB(t), "notes")
+
+	n := &note{Text: "first"}
+	if err := notes.Put(n); err != nil {
+		t.Fatalf("put: %s", err)
+	}
+	if n.ID != 1 {
+		t.Errorf("assigned id = %d, want 1", n.ID)
+	}
+	got, err := notes.Get(n.ID)
+	if err != nil || got.Text != "first" {
+		t.Fatalf("get = %+v, %v", got, err)
+	}
+
+	n.Text = "changed"
+	if err := notes.Put(n); err != nil {
+		t.Fatalf("put existing: %s", err)
+	}
+	if got, _ := notes.Get(n.ID); got.Text != "changed" {
+		t.Errorf("get after update = %+v", got)
+	}
+
+	if err := notes.Delete(n.ID); err != nil {
+		t.Fatalf("delete: %s", err)
+	}
+	if _, err := notes.Get(n.ID); err != ErrNoRows {
+		t.Errorf("get deleted = %v, want %v", err, ErrNoRows)
+	}
+	if err := notes.Delete(n.ID); err != ErrNoRows {
+		t.Errorf("delete missing = %v, want %v", err, ErrNoRows)
+	}
+}
+
+func TestRepositoryEmptyBucket(t *testing.T) {
+	notes := NewRepository[note](newTestDB(t), "notes")
+	if _, err := notes.Get(1); err != ErrNoRows {
+		t.Errorf("get = %v, want %v", err, ErrNoRows)
+	}
+	list, err := notes.List()
+	if err != nil || len(list) != 0 {
+		t.Errorf("list = %v, %v", list, err)
+	}
+}
+
+func TestRepositoryList(t *testing.T) {
+	notes := NewRepository[note](newTestDB(t), "notes")
+	for _, text := range []string{"a", "b", "c"} {
+		if err := notes.Put(&note{Text: text}); err != nil {
+			t.Fatalf("put: %s", err)
+		}
+	}
+	list, err := notes.List()
+	if err != nil {
+		t.Fatalf("list: %s", err)
+	}
+	if len(list) != 3 || list[0].Text != "a" || list[2].ID != 3 {
+		t.Errorf("list = %+v", list)
+	}
+}
+
+func TestRepositoryExplicitIDMovesSequence(t *testing.T) {
+	notes := NewRepository[note](newTestDB(t), "notes")
+	if err := notes.Put(&note{ID: 5, Text: "explicit"}); err != nil {
+		t.Fatalf("put explicit: %s", err)
+	}
+	auto := &note{Text: "auto"}
+	if err := notes.Put(auto); err != nil {
+		t.Fatalf("put auto: %s", err)
+	}
+	if auto.ID != 6 {
+		t.Errorf("auto id = %d, want 6", auto.ID)
+	}
+	if got, _ := notes.Get(5); got.Text != "explicit" {
+		t.Errorf("explicit record = %+v", got)
+	}
+}
+
+func TestRepositoryAutoIDDoesNotOverwrite(t *testing.T) {
+	db := newTestDB(t)
+	notes := NewRepository[note](db, "notes")
+	// A record written behind the sequence, as by an import
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("notes"))
+		if err != nil {
+			return err
+		}
+		return b.Put(itob(1), []byte(`{"id":1,"text":"imported"}`))
+	})
+	if err != nil {
+		t.Fatalf("import: %s", err)
+	}
+
+	n := &note{Text: "auto"}
+	if err := notes.Put(n); err != ErrDuplicateRow {
+		t.Errorf("put auto = %v, want %v", err, ErrDuplicateRow)
+	}
+	if n.ID != 0 {
+		t.Errorf("failed put set id %d", n.ID)
+	}
+	if got, _ := notes.Get(1); got.Text != "imported" {
+		t.Errorf("imported record = %+v", got)
+	}
+}
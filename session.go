@@ -0,0 +1,352 @@
+package base
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// userSessionsBucket indexes sessions by user, keyed by user ID followed by session ID
+var userSessionsBucket = []byte("user_sessions")
+
+// ErrInvalidCookie for session cookie with a bad signature or format
+var ErrInvalidCookie = errors.New("session: invalid cookie")
+
+// DefaultSessionCookieName is the cookie name used by a new SessionStore
+const DefaultSessionCookieName = "base_session"
+
+// sessionIDLen is the number of random bytes in a session ID
+const sessionIDLen = 32
+
+// Session is a server-side session stored in the sessions bucket
+type Session struct {
+	ID        string            `json:"id"`
+	UserID    uint64            `json:"userId"`
+	Values    map[string]string `json:"values"`
+	CreatedAt time.Time         `json:"createdAt"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+}
+
+// Expired reports whether the session is past its expiry time
+func (s *Session) Expired() bool {
+	return !TimeNow().Before(s.ExpiresAt)
+}
+
+// SessionStore persists sessions in bolt and issues signed session cookies
+type SessionStore struct {
+	db      *DB
+	secrets [][]byte
+	maxAge  time.Duration
+
+	// CookieName is the name of the session cookie
+	CookieName string
+	// Secure marks the session cookie as HTTPS only
+	Secure bool
+
+	mu   sync.Mutex
+	quit chan struct{}
+	done chan struct{}
+}
+
+// NewSessionStore return a session store signing cookies with secret.
+// Cookies signed with one of the previous secrets still verify, so the
+// secret can be rotated without logging everyone out.
+// Sessions expire maxAge after they are created.
+func NewSessionStore(db *DB, secret []byte, maxAge time.Duration, previous ...[]byte) *SessionStore {
+	return &SessionStore{
+		db:         db,
+		secrets:    append([][]byte{secret}, previous...),
+		maxAge:     maxAge,
+		CookieName: DefaultSessionCookieName,
+	}
+}
+
+// New creates and saves a session for the user. A zero userID creates an
+// anonymous session.
+func (ss *SessionStore) New(userID uint64) (*Session, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+	now := TimeNow()
+	s := &Session{
+		ID:        id,
+		UserID:    userID,
+		Values:    map[string]string{},
+		CreatedAt: now,
+		ExpiresAt: now.Add(ss.maxAge),
+	}
+	return s, ss.Save(s)
+}
+
+// Save writes the session to the sessions bucket
+func (ss *SessionStore) Save(s *Session) error {
+	buf, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("db: error encoding session: %s", err)
+	}
+	return ss.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(sessionsBucket)
+		var old Session
+		if v := b.Get([]byte(s.ID)); v != nil && json.Unmarshal(v, &old) == nil && old.UserID != s.UserID {
+			if err := tx.Bucket(userSessionsBucket).Delete(userSessionKey(old.UserID, old.ID)); err != nil {
+				return err
+			}
+		}
+		if err := b.Put([]byte(s.ID), buf); err != nil {
+			return err
+		}
+		if s.UserID == 0 {
+			return nil
+		}
+		return tx.Bucket(userSessionsBucket).Put(userSessionKey(s.UserID, s.ID), nil)
+	})
+}
+
+// Get return the session with id. Expired sessions are deleted and
+// reported as ErrNoRows.
+func (ss *SessionStore) Get(id string) (*Session, error) {
+	var s Session
+	err := ss.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(sessionsBucket).Get([]byte(id))
+		if v == nil {
+			return ErrNoRows
+		}
+		return json.Unmarshal(v, &s)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if s.Expired() {
+		if err := ss.Delete(s.ID); err != nil {
+			return nil, err
+		}
+		return nil, ErrNoRows
+	}
+	return &s, nil
+}
+
+// Delete removes the session with id
+func (ss *SessionStore) Delete(id string) error {
+	return ss.db.Update(func(tx *bolt.Tx) error {
+		return deleteSession(tx, []byte(id))
+	})
+}
+
+// Regenerate replaces old with a new session ID bound to userID, keeping
+// its values. It should be called on login to prevent session fixation.
+func (ss *SessionStore) Regenerate(old *Session, userID uint64) (*Session, error) {
+	s, err := ss.New(userID)
+	if err != nil {
+		return nil, err
+	}
+	if old == nil {
+		return s, nil
+	}
+	for k, v := range old.Values {
+		s.Values[k] = v
+	}
+	if err := ss.Save(s); err != nil {
+		return nil, err
+	}
+	if err := ss.Delete(old.ID); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// RevokeUser deletes every session belonging to the user
+func (ss *SessionStore) RevokeUser(userID uint64) error {
+	return ss.db.Update(func(tx *bolt.Tx) error {
+		prefix := itob(userID)
+		var ids [][]byte
+		c := tx.Bucket(userSessionsBucket).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			ids = append(ids, append([]byte(nil), k[len(prefix):]...))
+		}
+		for _, id := range ids {
+			if err := deleteSession(tx, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteExpired removes all expired sessions and return how many were removed
+func (ss *SessionStore) DeleteExpired() (int, error) {
+	n := 0
+	err := ss.db.Update(func(tx *bolt.Tx) error {
+		var ids [][]byte
+		err := tx.Bucket(sessionsBucket).ForEach(func(k, v []byte) error {
+			var s Session
+			if err := json.Unmarshal(v, &s); err != nil || s.Expired() {
+				ids = append(ids, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := deleteSession(tx, id); err != nil {
+				return err
+			}
+		}
+		n = len(ids)
+		return nil
+	})
+	return n, err
+}
+
+// StartSweeper deletes expired sessions every interval until Close is called.
+// errFn, if not nil, receives sweep errors.
+func (ss *SessionStore) StartSweeper(interval time.Duration, errFn func(error)) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.quit != nil {
+		return
+	}
+	ss.quit = make(chan struct{})
+	ss.done = make(chan struct{})
+	go func(quit, done chan struct{}) {
+		defer close(done)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if _, err := ss.DeleteExpired(); err != nil && errFn != nil {
+					errFn(err)
+				}
+			case <-quit:
+				return
+			}
+		}
+	}(ss.quit, ss.done)
+}
+
+// Running reports whether the sweeper goroutine is alive
+func (ss *SessionStore) Running() bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return alive(ss.done)
+}
+
+// Close stops the sweeper and waits for it to exit
+func (ss *SessionStore) Close() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.quit == nil {
+		return
+	}
+	close(ss.quit)
+	<-ss.done
+	ss.quit, ss.done = nil, nil
+}
+
+// Cookie return the signed session cookie for s
+func (ss *SessionStore) Cookie(s *Session) *http.Cookie {
+	return &http.Cookie{
+		Name:     ss.CookieName,
+		Value:    s.ID + "." + sign(ss.secrets[0], s.ID),
+		Path:     "/",
+		Expires:  s.ExpiresAt,
+		MaxAge:   int(s.ExpiresAt.Sub(TimeNow()).Seconds()),
+		Secure:   ss.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// ExpiredCookie return a cookie that clears the session cookie in the browser
+func (ss *SessionStore) ExpiredCookie() *http.Cookie {
+	return &http.Cookie{
+		Name:     ss.CookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   ss.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// Load return the session referenced by the request's session cookie.
+// It returns ErrNoRows if there is no cookie or the session is gone and
+// ErrInvalidCookie if the cookie signature does not verify.
+func (ss *SessionStore) Load(req *http.Request) (*Session, error) {
+	c, err := req.Cookie(ss.CookieName)
+	if err != nil {
+		return nil, ErrNoRows
+	}
+	id, err := ss.verify(c.Value)
+	if err != nil {
+		return nil, err
+	}
+	return ss.Get(id)
+}
+
+// sign return the HMAC of the session id with secret
+func sign(secret []byte, id string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verify checks a cookie value against every secret and return the
+// session id it carries
+func (ss *SessionStore) verify(value string) (string, error) {
+	i := strings.LastIndex(value, ".")
+	if i <= 0 {
+		return "", ErrInvalidCookie
+	}
+	id, sig := value[:i], value[i+1:]
+	for _, secret := range ss.secrets {
+		if hmac.Equal([]byte(sig), []byte(sign(secret, id))) {
+			return id, nil
+		}
+	}
+	return "", ErrInvalidCookie
+}
+
+// deleteSession removes a session and its user index entry
+func deleteSession(tx *bolt.Tx, id []byte) error {
+	b := tx.Bucket(sessionsBucket)
+	v := b.Get(id)
+	if v == nil {
+		return nil
+	}
+	var s Session
+	if err := json.Unmarshal(v, &s); err == nil && s.UserID != 0 {
+		if err := tx.Bucket(userSessionsBucket).Delete(userSessionKey(s.UserID, s.ID)); err != nil {
+			return err
+		}
+	}
+	return b.Delete(id)
+}
+
+// userSessionKey return the user index key of a session
+func userSessionKey(userID uint64, id string) []byte {
+	return append(itob(userID), id...)
+}
+
+// newSessionID return a random URL safe session ID
+func newSessionID() (string, error) {
+	b := make([]byte, sessionIDLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,182 @@
+package base
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// requestWithCookie return a request carrying c
+func requestWithCookie(c *http.Cookie) *http.Request {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(c)
+	return req
+}
+
+func TestSessionStoreNewAndGet(t *testing.T) {
+	ss := NewSessionStore(newTestDB(t), []byte("secret"), time.Hour)
+	s, err := ss.New(7)
+	if err != nil {
+		t.Fatalf("new: %s", err)
+	}
+	s.Values["k"] = "v"
+	if err := ss.Save(s); err != nil {
+		t.Fatalf("save: %s", err)
+	}
+
+	got, err := ss.Get(s.ID)
+	if err != nil {
+		t.Fatalf("get: %s", err)
+	}
+	if got.UserID != 7 || got.Values["k"] != "v" {
+		t.Errorf("get = %+v", got)
+	}
+
+	if err := ss.Delete(s.ID); err != nil {
+		t.Fatalf("delete: %s", err)
+	}
+	if _, err := ss.Get(s.ID); err != ErrNoRows {
+		t.Errorf("get deleted = %v, want %v", err, ErrNoRows)
+	}
+}
+
+func TestSessionStoreExpired(t *testing.T) {
+	db := newTestDB(t)
+	ss := NewSessionStore(db, []byte("secret"), time.Hour)
+	live, err := ss.New(1)
+	if err != nil {
+		t.Fatalf("new: %s", err)
+	}
+	old, err := ss.New(1)
+	if err != nil {
+		t.Fatalf("new: %s", err)
+	}
+	old.ExpiresAt = TimeNow().Add(-time.Second)
+	if err := ss.Save(old); err != nil {
+		t.Fatalf("save: %s", err)
+	}
+
+	n, err := ss.DeleteExpired()
+	if err != nil || n != 1 {
+		t.Fatalf("delete expired = %d, %v, want 1", n, err)
+	}
+	if _, err := ss.Get(live.ID); err != nil {
+		t.Errorf("get live session: %s", err)
+	}
+
+	old, err = ss.New(1)
+	if err != nil {
+		t.Fatalf("new: %s", err)
+	}
+	old.ExpiresAt = TimeNow().Add(-time.Second)
+	if err := ss.Save(old); err != nil {
+		t.Fatalf("save: %s", err)
+	}
+	if _, err := ss.Get(old.ID); err != ErrNoRows {
+		t.Errorf("get expired = %v, want %v", err, ErrNoRows)
+	}
+}
+
+func TestSessionStoreCookie(t *testing.T) {
+	db := newTestDB(t)
+	ss := NewSessionStore(db, []byte("secret"), time.Hour)
+	s, err := ss.New(1)
+	if err != nil {
+		t.Fatalf("new: %s", err)
+	}
+	c := ss.Cookie(s)
+	if !c.HttpOnly || c.Name != DefaultSessionCookieName {
+		t.Errorf("cookie = %+v", c)
+	}
+
+	got, err := ss.Load(requestWithCookie(c))
+	if err != nil || got.ID != s.ID {
+		t.Fatalf("load = %v, %v", got, err)
+	}
+
+	tampered := *c
+	tampered.Value = s.ID + ".bad"
+	if _, err := ss.Load(requestWithCookie(&tampered)); err != ErrInvalidCookie {
+		t.Errorf("load tampered = %v, want %v", err, ErrInvalidCookie)
+	}
+	if _, err := ss.Load(httptest.NewRequest("GET", "/", nil)); err != ErrNoRows {
+		t.Errorf("load without cookie = %v, want %v", err, ErrNoRows)
+	}
+
+	// A rotated secret still verifies cookies signed with the previous one
+	rotated := NewSessionStore(db, []byte("new secret"), time.Hour, []byte("secret"))
+	if _, err := rotated.Load(requestWithCookie(c)); err != nil {
+		t.Errorf("load with previous secret: %s", err)
+	}
+	other := NewSessionStore(db, []byte("new secret"), time.Hour)
+	if _, err := other.Load(requestWithCookie(c)); err != ErrInvalidCookie {
+		t.Errorf("load with another secret = %v, want %v", err, ErrInvalidCookie)
+	}
+}
+
+func TestSessionStoreRegenerate(t *testing.T) {
+	ss := NewSessionStore(newTestDB(t), []byte("secret"), time.Hour)
+	old, err := ss.New(0)
+	if err != nil {
+		t.Fatalf("new: %s", err)
+	}
+	old.Values["cart"] = "3"
+	if err := ss.Save(old); err != nil {
+		t.Fatalf("save: %s", err)
+	}
+
+	s, err := ss.Regenerate(old, 5)
+	if err != nil {
+		t.Fatalf("regenerate: %s", err)
+	}
+	if s.ID == old.ID || s.UserID != 5 || s.Values["cart"] != "3" {
+		t.Errorf("regenerated = %+v", s)
+	}
+	if _, err := ss.Get(old.ID); err != ErrNoRows {
+		t.Errorf("get old session = %v, want %v", err, ErrNoRows)
+	}
+}
+
+func TestSessionStoreRevokeUser(t *testing.T) {
+	ss := NewSessionStore(newTestDB(t), []byte("secret"), time.Hour)
+	var mine []*Session
+	for i := 0; i < 3; i++ {
+		s, err := ss.New(1)
+		if err != nil {
+			t.Fatalf("new: %s", err)
+		}
+		mine = append(mine, s)
+	}
+	theirs, err := ss.New(2)
+	if err != nil {
+		t.Fatalf("new: %s", err)
+	}
+
+	if err := ss.RevokeUser(1); err != nil {
+		t.Fatalf("revoke: %s", err)
+	}
+	for _, s := range mine {
+		if _, err := ss.Get(s.ID); err != ErrNoRows {
+			t.Errorf("get revoked session = %v, want %v", err, ErrNoRows)
+		}
+	}
+	if _, err := ss.Get(theirs.ID); err != nil {
+		t.Errorf("get session of another user: %s", err)
+	}
+}
+
+func TestSessionStoreSweeper(t *testing.T) {
+	ss := NewSessionStore(newTestDB(t), []byte("secret"), time.Hour)
+	if ss.Running() {
+		t.Fatal("sweeper running before start")
+	}
+	ss.StartSweeper(time.Millisecond, nil)
+	if !ss.Running() {
+		t.Fatal("sweeper not running after start")
+	}
+	ss.Close()
+	if ss.Running() {
+		t.Fatal("sweeper running after close")
+	}
+}
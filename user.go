@@ -0,0 +1,254 @@
+package base
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// usersByEmailBucket is the bucket of the unique email index of users,
+// maintained by the users Repository
+var usersByEmailBucket = []byte("users_by_email")
+
+// ErrEmptyEmail for user without email
+var ErrEmptyEmail = errors.New("user: email is empty")
+
+// ErrEmptyPassword for user without password
+var ErrEmptyPassword = errors.New("user: password is empty")
+
+const (
+	passwordScheme     = "pbkdf2-sha256"
+	passwordIterations = 100000
+	passwordSaltLen    = 16
+	passwordKeyLen     = 32
+)
+
+// User is an account stored in the users bucket
+type User struct {
+	ID           uint64    `json:"id"`
+	Email        string    `json:"email"`
+	Name         string    `json:"name"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// userRecord is the stored form of a user. Unlike User it keeps the
+// password hash when encoded, so User is safe to render in responses.
+type userRecord struct {
+	User
+	PasswordHash string `json:"passwordHash"`
+}
+
+// SetPassword hashes the password and stores it on the user
+func (u *User) SetPassword(password string) error {
+	if password == "" {
+		return ErrEmptyPassword
+	}
+	salt := make([]byte, passwordSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordIterations, passwordKeyLen)
+	if err != nil {
+		return err
+	}
+	u.PasswordHash = strings.Join([]string{
+		passwordScheme,
+		strconv.Itoa(passwordIterations),
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	}, "$")
+	return nil
+}
+
+// CheckPassword reports whether password matches the stored hash
+func (u *User) CheckPassword(password string) bool {
+	parts := strings.Split(u.PasswordHash, "$")
+	if len(parts) != 4 || parts[0] != passwordScheme {
+		return false
+	}
+	iter, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	got, err := pbkdf2.Key(sha256.New, password, salt, iter, len(want))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// normalizeEmail return the email in the form used by the email index
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// itob returns an 8-byte big endian representation of v
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+// btoi decodes an 8-byte big endian key
+func btoi(b []byte) uint64 {
+	return binary.BigEndian.Uint64(b)
+}
+
+// GetID return the user ID, User implements Entity
+func (u *User) GetID() uint64 {
+	return u.ID
+}
+
+// SetID sets the user ID
+func (u *User) SetID(id uint64) {
+	u.ID = id
+}
+
+// UserStore reads and writes users in the users bucket. Users are kept in
+// a Repository with a unique index on the email.
+type UserStore struct {
+	repo *Repository[userRecord, *userRecord]
+}
+
+// Users return the user store of db
+func (db *DB) Users() *UserStore {
+	repo := NewRepository[userRecord](db, string(usersBucket))
+	repo.addIndex("email", true, func(r *userRecord) []byte {
+		return []byte(r.Email)
+	})
+	return &UserStore{repo: repo}
+}
+
+// Create stores a new user with the given password.
+// The user's ID and timestamps are set on success.
+func (s *UserStore) Create(u *User, password string) error {
+	u.Email = normalizeEmail(u.Email)
+	if u.Email == "" {
+		return ErrEmptyEmail
+	}
+	if err := u.SetPassword(password); err != nil {
+		return err
+	}
+	now := TimeNow()
+	r := newUserRecord(u)
+	r.ID = 0
+	r.CreatedAt, r.UpdatedAt = now, now
+	if err := s.repo.Put(r); err != nil {
+		return err
+	}
+	*u = r.user()
+	return nil
+}
+
+// GetByID return the user with id
+func (s *UserStore) GetByID(id uint64) (*User, error) {
+	r, err := s.repo.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	u := r.user()
+	return &u, nil
+}
+
+// GetByEmail return the user with email
+func (s *UserStore) GetByEmail(email string) (*User, error) {
+	r, err := s.repo.GetBy("email", []byte(normalizeEmail(email)))
+	if err != nil {
+		return nil, err
+	}
+	u := r.user()
+	return &u, nil
+}
+
+// Update saves changes to an existing user, keeping the email index in sync.
+// An empty PasswordHash keeps the stored password.
+func (s *UserStore) Update(u *User) error {
+	u.Email = normalizeEmail(u.Email)
+	if u.Email == "" {
+		return ErrEmptyEmail
+	}
+	return s.repo.db.Update(func(tx *bolt.Tx) error {
+		old, err := s.repo.GetTx(tx, u.ID)
+		if err != nil {
+			return err
+		}
+		r := newUserRecord(u)
+		if r.PasswordHash == "" {
+			r.PasswordHash = old.PasswordHash
+		}
+		r.CreatedAt = old.CreatedAt
+		r.UpdatedAt = TimeNow()
+		if err := s.repo.PutTx(tx, r); err != nil {
+			return err
+		}
+		*u = r.user()
+		return nil
+	})
+}
+
+// Delete removes the user with id
+func (s *UserStore) Delete(id uint64) error {
+	return s.repo.Delete(id)
+}
+
+// List return all users ordered by ID
+func (s *UserStore) List() ([]*User, error) {
+	records, err := s.repo.List()
+	return users(records), err
+}
+
+// Bucket return the users bucket name
+func (s *UserStore) Bucket() []byte {
+	return s.repo.Bucket()
+}
+
+// VerifyIndexes compares the email index with the users bucket
+func (s *UserStore) VerifyIndexes() ([]IndexProblem, error) {
+	return s.repo.VerifyIndexes()
+}
+
+// RebuildIndexes recreates the email index from the users bucket
+func (s *UserStore) RebuildIndexes() error {
+	return s.repo.RebuildIndexes()
+}
+
+// newUserRecord return the stored form of u
+func newUserRecord(u *User) *userRecord {
+	return &userRecord{User: *u, PasswordHash: u.PasswordHash}
+}
+
+// user return the user of a stored record, with its password hash
+func (r *userRecord) user() User {
+	u := r.User
+	u.PasswordHash = r.PasswordHash
+	return u
+}
+
+// users return the users of stored records
+func users(records []*userRecord) []*User {
+	list := make([]*User, 0, len(records))
+	for _, r := range records {
+		u := r.user()
+		list = append(list, &u)
+	}
+	return list
+}
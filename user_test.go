@@ -0,0 +1,149 @@
+package base
+
+import (
+	"testing"
+)
+
+func createUser(t *testing.T, s *UserStore, email string) *User {
+	t.Helper()
+	u := &User{Email: email, Name: "name"}
+	if err := s.Create(u, "password"); err != nil {
+		t.Fatalf("create %s: %s", email, err)
+	}
+	return u
+}
+
+func TestUserStoreCreateAndGet(t *testing.T) {
+	s := newTestDB(t).Users()
+	u := createUser(t, s, " Alice@Example.com ")
+	if u.ID != 1 || u.Email != "alice@example.com" || u.CreatedAt.IsZero() {
+		t.Fatalf("created user = %+v", u)
+	}
+
+	got, err := s.GetByID(u.ID)
+	if err != nil {
+		t.Fatalf("get by id: %s", err)
+	}
+	if got.Email != u.Email || got.PasswordHash == "" {
+		t.Errorf("get by id = %+v", got)
+	}
+
+	got, err = s.GetByEmail("ALICE@example.com")
+	if err != nil {
+		t.Fatalf("get by email: %s", err)
+	}
+	if got.ID != u.ID {
+		t.Errorf("get by email id = %d, want %d", got.ID, u.ID)
+	}
+}
+
+func TestUserStoreCreateErrors(t *testing.T) {
+	s := newTestDB(t).Users()
+	createUser(t, s, "bob@example.com")
+
+	tests := []struct {
+		email, password string
+		want            error
+	}{
+		{"bob@example.com", "password", ErrDuplicateRow},
+		{"BOB@Example.COM", "password", ErrDuplicateRow},
+		{" ", "password", ErrEmptyEmail},
+		{"carol@example.com", "", ErrEmptyPassword},
+	}
+	for _, tt := range tests {
+		if err := s.Create(&User{Email: tt.email}, tt.password); err != tt.want {
+			t.Errorf("create %q = %v, want %v", tt.email, err, tt.want)
+		}
+	}
+}
+
+func TestUserStoreNoRows(t *testing.T) {
+	s := newTestDB(t).Users()
+	if _, err := s.GetByID(42); err != ErrNoRows {
+		t.Errorf("get by id = %v, want %v", err, ErrNoRows)
+	}
+	if _, err := s.GetByEmail("nobody@example.com"); err != ErrNoRows {
+		t.Errorf("get by email = %v, want %v", err, ErrNoRows)
+	}
+	if err := s.Update(&User{ID: 42, Email: "nobody@example.com"}); err != ErrNoRows {
+		t.Errorf("update = %v, want %v", err, ErrNoRows)
+	}
+	if err := s.Delete(42); err != ErrNoRows {
+		t.Errorf("delete = %v, want %v", err, ErrNoRows)
+	}
+}
+
+func TestUserStoreUpdate(t *testing.T) {
+	s := newTestDB(t).Users()
+	u := createUser(t, s, "dave@example.com")
+	createUser(t, s, "erin@example.com")
+	hash := u.PasswordHash
+
+	u.Email = "David@Example.com"
+	u.PasswordHash = ""
+	if err := s.Update(u); err != nil {
+		t.Fatalf("update: %s", err)
+	}
+	if _, err := s.GetByEmail("dave@example.com"); err != ErrNoRows {
+		t.Errorf("old email lookup = %v, want %v", err, ErrNoRows)
+	}
+	got, err := s.GetByEmail("david@example.com")
+	if err != nil {
+		t.Fatalf("new email lookup: %s", err)
+	}
+	if got.PasswordHash != hash {
+		t.Error("update with an empty hash changed the password")
+	}
+
+	u.Email = "ERIN@example.com"
+	if err := s.Update(u); err != ErrDuplicateRow {
+		t.Errorf("update to a taken email = %v, want %v", err, ErrDuplicateRow)
+	}
+}
+
+func TestUserStoreDeleteAndList(t *testing.T) {
+	s := newTestDB(t).Users()
+	a := createUser(t, s, "a@example.com")
+	b := createUser(t, s, "b@example.com")
+	c := createUser(t, s, "c@example.com")
+
+	if err := s.Delete(b.ID); err != nil {
+		t.Fatalf("delete: %s", err)
+	}
+	if _, err := s.GetByEmail("b@example.com"); err != ErrNoRows {
+		t.Errorf("deleted email lookup = %v, want %v", err, ErrNoRows)
+	}
+	// The email of a deleted user is free again
+	createUser(t, s, "b@example.com")
+
+	users, err := s.List()
+	if err != nil {
+		t.Fatalf("list: %s", err)
+	}
+	var ids []uint64
+	for _, u := range users {
+		ids = append(ids, u.ID)
+	}
+	if len(ids) != 3 || ids[0] != a.ID || ids[1] != c.ID || ids[2] != 4 {
+		t.Errorf("list ids = %v, want [%d %d 4]", ids, a.ID, c.ID)
+	}
+}
+
+func TestUserCheckPassword(t *testing.T) {
+	u := &User{}
+	if u.CheckPassword("") {
+		t.Error("empty hash matched")
+	}
+	if err := u.SetPassword("correct horse"); err != nil {
+		t.Fatalf("set password: %s", err)
+	}
+	if !u.CheckPassword("correct horse") {
+		t.Error("right password did not match")
+	}
+	if u.CheckPassword("wrong horse") {
+		t.Error("wrong password matched")
+	}
+	if err := u.SetPassword(""); err != ErrEmptyPassword {
+		t.Errorf("set empty password = %v, want %v", err, ErrEmptyPassword)
+	}
+}